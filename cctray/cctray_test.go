@@ -0,0 +1,87 @@
+package cctray
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"tantalic.com/cistatus"
+)
+
+const feedXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Projects>
+	<Project name="api/master" activity="Sleeping" lastBuildStatus="Success" lastBuildLabel="abc123" lastBuildTime="2017-04-11T20:00:00Z" webUrl="https://ci.example.com/api"/>
+	<Project name="api/develop" activity="Building" lastBuildStatus="Failure" lastBuildLabel="def456" lastBuildTime="2017-04-11T19:00:00.123"/>
+	<Project name="web/master" activity="Sleeping" lastBuildStatus="Exception" lastBuildLabel="7" lastBuildTime="yesterday"/>
+	<Project name="docs" activity="Sleeping" lastBuildStatus="Unknown"/>
+</Projects>`
+
+func TestFetchStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		if username != "ci" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(feedXML))
+	}))
+	defer server.Close()
+
+	feed, err := NewFeed("http://ci:secret@" + server.Listener.Addr().String() + "/cc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projects, err := NewClient(feed).FetchStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []cistatus.Project{
+		{Name: "api", Branches: []cistatus.Branch{
+			{Name: "master", Commit: "abc123", Statuses: []cistatus.Status{
+				{Name: "api/master", Status: "success", Created: time.Date(2017, 4, 11, 20, 0, 0, 0, time.UTC)},
+			}},
+			{Name: "develop", Commit: "def456", Statuses: []cistatus.Status{
+				{Name: "api/develop", Status: "running", Created: time.Date(2017, 4, 11, 19, 0, 0, 123000000, time.UTC)},
+			}},
+		}},
+		{Name: "web", Branches: []cistatus.Branch{
+			{Name: "master", Commit: "7", Statuses: []cistatus.Status{
+				{Name: "web/master", Status: "failed"},
+			}},
+		}},
+		{Name: "docs", Branches: []cistatus.Branch{
+			{Name: "master", Statuses: []cistatus.Status{
+				{Name: "docs", Status: "created"},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(projects, want) {
+		t.Errorf("unexpected projects\n got: %+v\nwant: %+v", projects, want)
+	}
+}
+
+func TestState(t *testing.T) {
+	tests := []struct {
+		activity, lastBuildStatus, want string
+	}{
+		{"Sleeping", "Success", "success"},
+		{"Sleeping", "Failure", "failed"},
+		{"Sleeping", "Exception", "failed"},
+		{"Building", "Failure", "running"},
+		{"CheckingModifications", "Success", "success"},
+		// Never built projects must not turn the summary unknown
+		{"Sleeping", "Unknown", "created"},
+		{"Sleeping", "Broken", cistatus.UnknownStatus},
+	}
+
+	for _, test := range tests {
+		if got := state(test.activity, test.lastBuildStatus); got != test.want {
+			t.Errorf("state(%q, %q) = %q, want %q", test.activity, test.lastBuildStatus, got, test.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cistatus
 
 import (
+	"context"
 	"time"
 )
 
@@ -8,12 +9,61 @@ const (
 	Version = "0.2.2"
 )
 
+// Fetcher fetches the status of projects from a CI server. Implementations
+// should abandon the fetch and return once ctx is done.
 type Fetcher interface {
+	FetchStatus(ctx context.Context) ([]Project, error)
+}
+
+// WatchingFetcher is a Fetcher that can tell when the status may have
+// changed. The server fetches immediately each time a value is received from
+// the channel returned by Watch, in addition to polling. The channel should
+// be closed once ctx is done.
+type WatchingFetcher interface {
+	Fetcher
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// LegacyFetcher is the context-less Fetcher interface used before
+// FetchStatus accepted a context.
+type LegacyFetcher interface {
 	FetchStatus() ([]Project, error)
 }
 
+// AdaptLegacyFetcher wraps a LegacyFetcher so it satisfies Fetcher. When ctx
+// is done before the wrapped fetch returns, ctx.Err() is returned
+// immediately and the result of the fetch is discarded once it completes.
+func AdaptLegacyFetcher(f LegacyFetcher) Fetcher {
+	return legacyFetcher{f}
+}
+
+type legacyFetcher struct {
+	LegacyFetcher
+}
+
+func (l legacyFetcher) FetchStatus(ctx context.Context) ([]Project, error) {
+	type result struct {
+		projects []Project
+		err      error
+	}
+
+	resultChan := make(chan result, 1)
+	go func() {
+		projects, err := l.LegacyFetcher.FetchStatus()
+		resultChan <- result{projects, err}
+	}()
+
+	select {
+	case r := <-resultChan:
+		return r.projects, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 type Project struct {
 	Name     string   `json:"name"`
+	URL      string   `json:"url,omitempty"`
 	Branches []Branch `json:"branches,omitempty"`
 }
 
@@ -25,17 +75,53 @@ type Branch struct {
 	Name     string   `json:"name"`
 	Commit   string   `json:"commit"`
 	Statuses []Status `json:"statuses,omitempty"`
+
+	// Flakiness is the highest flakiness of the statuses
+	Flakiness float64 `json:"flakiness,omitempty"`
+
+	// Color is the color of the branch computed by the server with the
+	// same policy as the summary color
+	Color Color `json:"color,omitempty"`
+
+	// While the branch is broken, BrokenBy and BrokenCommit are the author
+	// and commit of the first status that failed after it was last green
+	BrokenBy     string     `json:"brokenBy,omitempty"`
+	BrokenCommit string     `json:"brokenCommit,omitempty"`
+	BrokenSince  *time.Time `json:"brokenSince,omitempty"`
 }
 
 func (b Branch) String() string {
 	return b.Name
 }
 
+// UnknownStatus is the status of a job whose state cannot be known, such as
+// a job of an unreachable relay upstream. It makes the color Unknown.
+const UnknownStatus = "unknown"
+
 type Status struct {
-	Name    string    `json:"name"`
-	Status  string    `json:"status"`
-	Created time.Time `json:"created"`
-	Author  string    `json:"author"`
+	Name    string     `json:"name"`
+	Status  string     `json:"status"`
+	Created time.Time  `json:"created"`
+	Author  string     `json:"author"`
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// Flakiness is the fraction of the recent runs of the job, on any
+	// branch of the project, that failed and then passed with the same
+	// commit
+	Flakiness float64 `json:"flakiness,omitempty"`
+
+	// Retry is set when the status is a pending or running retry of a run
+	// of the job that failed with the same commit. A retry counts as the
+	// failure until it finishes.
+	Retry bool `json:"retry,omitempty"`
+
+	// Ack is set when the status is a failure someone acknowledged
+	Ack *Ack `json:"ack,omitempty"`
+}
+
+// failing reports whether the status is a failure or the retry of one
+func (s Status) failing() bool {
+	return s.Status == "failed" || s.Retry
 }
 
 func (s Status) String() string {
@@ -46,6 +132,36 @@ type Summary struct {
 	Projects    []Project  `json:"projects,omitempty"`
 	Color       Color      `json:"color"`
 	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+
+	// Restored is set when the summary was loaded from the state file and
+	// has not yet been refreshed by a successful fetch
+	Restored bool `json:"restored,omitempty"`
+
+	// Culprits are who broke the branches that are broken
+	Culprits []Culprit `json:"culprits,omitempty"`
+
+	// Window is the quiet hours or maintenance window in effect, during
+	// which Color is Off or Maintenance and StatusColor is the color of
+	// the builds
+	Window      *Window `json:"window,omitempty"`
+	StatusColor Color   `json:"statusColor,omitempty"`
+}
+
+// Culprit is the author and commit that broke a branch
+type Culprit struct {
+	Project string    `json:"project"`
+	Branch  string    `json:"branch"`
+	Author  string    `json:"author,omitempty"`
+	Commit  string    `json:"commit,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+func (c Culprit) String() string {
+	author := c.Author
+	if author == "" {
+		author = "unknown"
+	}
+	return c.Project + "/" + c.Branch + " broken by " + author
 }
 
 type Color string
@@ -55,4 +171,12 @@ const (
 	Yellow  = Color("yellow")
 	Green   = Color("green")
 	Unknown = Color("question")
+
+	// Acknowledged is the color when every failure has been acknowledged
+	Acknowledged = Color("orange")
+
+	// Off and Maintenance are the colors during quiet hours and maintenance
+	// windows, whatever the status of the builds
+	Off         = Color("black")
+	Maintenance = Color("white")
 )
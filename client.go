@@ -2,6 +2,7 @@ package cistatus
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -11,6 +12,15 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	// defaultSummaryTimeout applies to Summary when the context has no
+	// deadline
+	defaultSummaryTimeout = 50 * time.Millisecond
+
+	// watchHandshakeTimeout limits how long subscribing may take
+	watchHandshakeTimeout = 10 * time.Second
+)
+
 type Client struct {
 	HTTPClient http.Client
 	Token      string
@@ -18,6 +28,10 @@ type Client struct {
 	Hostname string
 	Port     int
 	UseTLS   bool
+
+	// TLSConfig is used for connections to the server when UseTLS is set.
+	// It is ignored by Summary if HTTPClient has a Transport.
+	TLSConfig *tls.Config
 }
 
 func (c *Client) Summary(ctx context.Context) (*Summary, error) {
@@ -31,20 +45,35 @@ func (c *Client) Summary(ctx context.Context) (*Summary, error) {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultSummaryTimeout)
+		defer cancel()
+	}
 	if c.Token != "" {
 		auth := fmt.Sprintf("bearer %s", c.Token)
 		req.Header.Add("Authorization", auth)
 	}
-	defer cancel()
 	req = req.WithContext(ctx)
 
-	resp, err := c.HTTPClient.Do(req)
+	client := c.HTTPClient
+	if c.TLSConfig != nil && client.Transport == nil {
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: c.TLSConfig,
+		}
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected response %s", resp.Status)
+	}
+
 	var summary Summary
 	err = json.NewDecoder(resp.Body).Decode(&summary)
 	if err != nil {
@@ -74,28 +103,61 @@ func (c *Client) summaryURL() (string, error) {
 }
 
 func (c *Client) Watch(summChan chan Summary) error {
+	return c.WatchContext(context.Background(), summChan)
+}
+
+// WatchContext subscribes to the server and sends each summary it receives
+// to summChan until the connection fails or ctx is done. The Token, if set,
+// is sent with the subscription request.
+func (c *Client) WatchContext(ctx context.Context, summChan chan<- Summary) error {
 	URL, err := c.watchURL()
 	if err != nil {
 		return err
 	}
 
-	var dialer *websocket.Dialer
-	conn, _, err := dialer.Dial(URL, nil)
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("Authorization", fmt.Sprintf("bearer %s", c.Token))
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  c.TLSConfig,
+		HandshakeTimeout: watchHandshakeTimeout,
+	}
+	conn, _, err := dialer.Dial(URL, header)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
+
+	// Closing the connection unblocks ReadJSON once ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
 
 	for {
 		var summary Summary
 		err := conn.ReadJSON(&summary)
 		if err != nil {
-			conn.Close()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return err
 		}
 
-		summChan <- summary
+		select {
+		case summChan <- summary:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-
 }
 
 func (c *Client) watchURL() (string, error) {
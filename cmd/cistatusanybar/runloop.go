@@ -38,7 +38,13 @@ func runloop(conf config) error {
 		for {
 			status := <-summaryChan
 
-			logger.Printf("received status: %s\n", status)
+			logger.Printf("received status: %s\n", status.Color)
+			for _, culprit := range status.Culprits {
+				logger.Printf("%s\n", culprit)
+			}
+			if status.Window != nil {
+				logger.Printf("%s window until %s\n", status.Window.Kind, status.Window.Until)
+			}
 			anybarClient.Set(anybar.Style(status.Color))
 		}
 	}()
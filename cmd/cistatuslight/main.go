@@ -120,13 +120,17 @@ func NewStatusLightRobot(c config, summaryChan chan cistatus.Summary) *gobot.Rob
 			summary := <-summaryChan
 			log.Printf("Received status update: %s\n", summary.Color)
 
-			if summary.Color == cistatus.Red {
+			// Off and Maintenance match none of the colors below so the
+			// light stays dark during quiet hours and maintenance windows
+
+			// Acknowledged failures light both red and yellow
+			if summary.Color == cistatus.Red || summary.Color == cistatus.Acknowledged {
 				red.Off()
 			} else {
 				red.On()
 			}
 
-			if summary.Color == cistatus.Yellow {
+			if summary.Color == cistatus.Yellow || summary.Color == cistatus.Acknowledged {
 				yellow.Off()
 			} else {
 				yellow.On()
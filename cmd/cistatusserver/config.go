@@ -1,14 +1,24 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
 	"log"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"tantalic.com/cistatus"
+	"tantalic.com/cistatus/cctray"
+	"tantalic.com/cistatus/exec"
+	"tantalic.com/cistatus/file"
+	"tantalic.com/cistatus/github"
 	"tantalic.com/cistatus/gitlab"
+	"tantalic.com/cistatus/relay"
 )
 
 const (
@@ -18,25 +28,116 @@ const (
 	GITLAB_API_TOKEN              = "GITLAB_API_TOKEN"
 	GITLAB_REFRESH_PERIOD         = "GITLAB_REFRESH_PERIOD"
 	GITLAB_REFRESH_PERIOD_DEFAULT = "10s"
+	GITLAB_FETCH_TIMEOUT          = "GITLAB_FETCH_TIMEOUT"
+	GITLAB_WEBHOOK_SECRET         = "GITLAB_WEBHOOK_SECRET"
+
+	// When webhooks are configured polling is only needed to reconcile
+	// missed events so it defaults to a much longer period
+	GITLAB_REFRESH_PERIOD_WEBHOOK_DEFAULT = "5m"
+
+	GITHUB_WEBHOOK_SECRET = "GITHUB_WEBHOOK_SECRET"
+
+	CCTRAY_URLS         = "CCTRAY_URLS"
+	CCTRAY_USERNAME     = "CCTRAY_USERNAME"
+	CCTRAY_PASSWORD     = "CCTRAY_PASSWORD"
+	CCTRAY_NAME_PATTERN = "CCTRAY_NAME_PATTERN"
+
+	CI_STATUS_FILE_PATH = "CI_STATUS_FILE_PATH"
+
+	// The command is split on whitespace. Each CI_STATUS_EXEC_ENV_<KEY>
+	// variable is passed to the command as <KEY>.
+	CI_STATUS_EXEC_COMMAND    = "CI_STATUS_EXEC_COMMAND"
+	CI_STATUS_EXEC_DIR        = "CI_STATUS_EXEC_DIR"
+	CI_STATUS_EXEC_ENV_PREFIX = "CI_STATUS_EXEC_ENV_"
+
+	// Upstreams are a comma separated list of zone=URL pairs. A username in
+	// the URL is used as the token for that upstream.
+	CI_STATUS_RELAY_UPSTREAMS = "CI_STATUS_RELAY_UPSTREAMS"
+	CI_STATUS_RELAY_TOKEN     = "CI_STATUS_RELAY_TOKEN"
+	CI_STATUS_RELAY_CA_FILE   = "CI_STATUS_RELAY_CA_FILE"
+
+	// The refresh period and fetch timeout apply to whichever CI server is
+	// polled. The GitLab specific names are still accepted.
+	CI_STATUS_REFRESH_PERIOD = "CI_STATUS_REFRESH_PERIOD"
+	CI_STATUS_FETCH_TIMEOUT  = "CI_STATUS_FETCH_TIMEOUT"
 
 	CI_STATUS_HTTP_SERVER_ADDRESS         = "CI_STATUS_HTTP_SERVER_ADDRESS"
 	CI_STATUS_HTTP_SERVER_ADDRESS_DEFAULT = ":80"
 
+	CI_STATUS_READY_INTERVALS = "CI_STATUS_READY_INTERVALS"
+	CI_STATUS_STATE_FILE      = "CI_STATUS_STATE_FILE"
+
+	CI_STATUS_HISTORY_DIR       = "CI_STATUS_HISTORY_DIR"
+	CI_STATUS_HISTORY_RETENTION = "CI_STATUS_HISTORY_RETENTION"
+	CI_STATUS_HISTORY_MAX_BYTES = "CI_STATUS_HISTORY_MAX_BYTES"
+
+	CI_STATUS_FLAKY_DOWNGRADE = "CI_STATUS_FLAKY_DOWNGRADE"
+	CI_STATUS_FLAKY_THRESHOLD = "CI_STATUS_FLAKY_THRESHOLD"
+
+	// Quiet hours are a daily range such as 19:00-07:00 and quiet days a
+	// comma separated list such as sat,sun, both in the time zone (an IANA
+	// name such as Europe/Berlin) or the local time zone when it is unset
+	CI_STATUS_QUIET_HOURS    = "CI_STATUS_QUIET_HOURS"
+	CI_STATUS_QUIET_DAYS     = "CI_STATUS_QUIET_DAYS"
+	CI_STATUS_QUIET_TIMEZONE = "CI_STATUS_QUIET_TIMEZONE"
+
 	CI_STATUS_HTTP_SERVER_JWT_ALGORITHM         = "CI_STATUS_HTTP_SERVER_JWT_ALGORITHM"
 	CI_STATUS_HTTP_SERVER_JWT_ALGORITHM_DEFAULT = "HS512"
 	CI_STATUS_HTTP_SERVER_JWT_SECRET            = "CI_STATUS_HTTP_SERVER_JWT_SECRET"
 )
 
+// sourceVariables are the environment variables that select the CI server
+// to fetch the status from, only one may be set
+var sourceVariables = []string{
+	GITLAB_API_BASE_URL,
+	CCTRAY_URLS,
+	CI_STATUS_FILE_PATH,
+	CI_STATUS_EXEC_COMMAND,
+	CI_STATUS_RELAY_UPSTREAMS,
+}
+
 type config struct {
 	Verbose bool
 
-	GitLabBaseURL         string
-	GitLabAPIToken        string
-	GitLabRefreshInterval time.Duration
+	RefreshInterval time.Duration
+	FetchTimeout    time.Duration
+
+	GitLabBaseURL       string
+	GitLabAPIToken      string
+	GitLabWebhookSecret string
+
+	GitHubWebhookSecret string
+
+	CCTrayFeeds       []cctray.Feed
+	CCTrayUsername    string
+	CCTrayPassword    string
+	CCTrayNamePattern *regexp.Regexp
+
+	FilePath string
+
+	ExecCommand []string
+	ExecDir     string
+	ExecEnv     []string
 
-	HTTPAddress  string
-	JWTAlgorithm string
-	JWTSecret    []byte
+	RelayUpstreams []*relay.Upstream
+
+	HTTPAddress    string
+	ReadyIntervals int
+	StateFile      string
+	JWTAlgorithm   string
+	JWTSecret      []byte
+
+	HistoryDir       string
+	HistoryRetention time.Duration
+	HistoryMaxBytes  int64
+
+	FlakyDowngrade bool
+	FlakyThreshold float64
+
+	QuietHours *cistatus.QuietHours
+
+	Subscriptions     []*cistatus.Subscription
+	StillFailingAfter time.Duration
 }
 
 func configFromEnv() (config, error) {
@@ -49,30 +150,147 @@ func configFromEnv() (config, error) {
 	c.Verbose = verbose
 
 	c.GitLabBaseURL = os.Getenv(GITLAB_API_BASE_URL)
-	if c.GitLabBaseURL == "" {
-		return c, errors.Errorf("%s environment variable is required", GITLAB_API_BASE_URL)
+	c.GitLabAPIToken = os.Getenv(GITLAB_API_TOKEN)
+	c.GitLabWebhookSecret = os.Getenv(GITLAB_WEBHOOK_SECRET)
+
+	var sources []string
+	for _, name := range sourceVariables {
+		if os.Getenv(name) != "" {
+			sources = append(sources, name)
+		}
+	}
+	if len(sources) > 1 {
+		return c, errors.Errorf("only one of %s may be set", strings.Join(sources, ", "))
 	}
 
-	c.GitLabAPIToken = os.Getenv(GITLAB_API_TOKEN)
-	if c.GitLabAPIToken == "" {
-		return c, errors.Errorf("%s environment variable is required", GITLAB_API_TOKEN)
+	cctrayURLs := os.Getenv(CCTRAY_URLS)
+	relayUpstreams := os.Getenv(CI_STATUS_RELAY_UPSTREAMS)
+	c.FilePath = os.Getenv(CI_STATUS_FILE_PATH)
+	c.ExecCommand = strings.Fields(os.Getenv(CI_STATUS_EXEC_COMMAND))
+
+	switch {
+	case cctrayURLs != "":
+		err = c.cctrayFromEnv(cctrayURLs)
+		if err != nil {
+			return c, err
+		}
+	case c.FilePath != "":
+		_, err = os.Stat(c.FilePath)
+		if err != nil {
+			return c, errors.Wrapf(err, "%s environment variable is invalid", CI_STATUS_FILE_PATH)
+		}
+	case len(c.ExecCommand) > 0:
+		c.ExecDir = os.Getenv(CI_STATUS_EXEC_DIR)
+		for _, env := range os.Environ() {
+			if strings.HasPrefix(env, CI_STATUS_EXEC_ENV_PREFIX) {
+				c.ExecEnv = append(c.ExecEnv, strings.TrimPrefix(env, CI_STATUS_EXEC_ENV_PREFIX))
+			}
+		}
+	case relayUpstreams != "":
+		err = c.relayFromEnv(relayUpstreams)
+		if err != nil {
+			return c, err
+		}
+	default:
+		if c.GitLabBaseURL == "" {
+			return c, errors.Errorf("%s environment variable is required", GITLAB_API_BASE_URL)
+		}
+
+		if c.GitLabAPIToken == "" {
+			return c, errors.Errorf("%s environment variable is required", GITLAB_API_TOKEN)
+		}
 	}
 
-	refreshPeriod := os.Getenv(GITLAB_REFRESH_PERIOD)
+	refreshPeriodVar, refreshPeriod := envFallback(CI_STATUS_REFRESH_PERIOD, GITLAB_REFRESH_PERIOD)
+	if refreshPeriod == "" && c.GitLabWebhookSecret != "" {
+		refreshPeriod = GITLAB_REFRESH_PERIOD_WEBHOOK_DEFAULT
+	}
 	if refreshPeriod == "" {
 		refreshPeriod = GITLAB_REFRESH_PERIOD_DEFAULT
 	}
 
-	c.GitLabRefreshInterval, err = time.ParseDuration(refreshPeriod)
+	c.RefreshInterval, err = time.ParseDuration(refreshPeriod)
 	if err != nil {
-		return c, errors.Wrapf(err, "%s environment variable is invalid", GITLAB_REFRESH_PERIOD)
+		return c, errors.Wrapf(err, "%s environment variable is invalid", refreshPeriodVar)
 	}
 
+	fetchTimeoutVar, fetchTimeout := envFallback(CI_STATUS_FETCH_TIMEOUT, GITLAB_FETCH_TIMEOUT)
+	if fetchTimeout != "" {
+		c.FetchTimeout, err = time.ParseDuration(fetchTimeout)
+		if err != nil {
+			return c, errors.Wrapf(err, "%s environment variable is invalid", fetchTimeoutVar)
+		}
+
+		if c.FetchTimeout >= c.RefreshInterval {
+			return c, errors.Errorf("%s must be shorter than %s", fetchTimeoutVar, refreshPeriodVar)
+		}
+	}
+
+	c.GitHubWebhookSecret = os.Getenv(GITHUB_WEBHOOK_SECRET)
+
 	c.HTTPAddress = os.Getenv(CI_STATUS_HTTP_SERVER_ADDRESS)
 	if c.HTTPAddress == "" {
 		c.HTTPAddress = CI_STATUS_HTTP_SERVER_ADDRESS_DEFAULT
 	}
 
+	readyIntervals := os.Getenv(CI_STATUS_READY_INTERVALS)
+	if readyIntervals != "" {
+		c.ReadyIntervals, err = strconv.Atoi(readyIntervals)
+		if err != nil || c.ReadyIntervals <= 0 {
+			return c, errors.Errorf("%s environment variable must be a positive integer", CI_STATUS_READY_INTERVALS)
+		}
+	}
+
+	c.StateFile = os.Getenv(CI_STATUS_STATE_FILE)
+
+	c.HistoryDir = os.Getenv(CI_STATUS_HISTORY_DIR)
+	c.HistoryRetention = cistatus.DefaultHistoryRetention
+	historyRetention := os.Getenv(CI_STATUS_HISTORY_RETENTION)
+	if historyRetention != "" {
+		c.HistoryRetention, err = time.ParseDuration(historyRetention)
+		if err != nil || c.HistoryRetention <= 0 {
+			return c, errors.Errorf("%s environment variable must be a positive duration", CI_STATUS_HISTORY_RETENTION)
+		}
+	}
+
+	c.HistoryMaxBytes = cistatus.DefaultHistoryMaxBytes
+	historyMaxBytes := os.Getenv(CI_STATUS_HISTORY_MAX_BYTES)
+	if historyMaxBytes != "" {
+		c.HistoryMaxBytes, err = strconv.ParseInt(historyMaxBytes, 10, 64)
+		if err != nil || c.HistoryMaxBytes <= 0 {
+			return c, errors.Errorf("%s environment variable must be a positive integer", CI_STATUS_HISTORY_MAX_BYTES)
+		}
+	}
+
+	flakyDowngrade := os.Getenv(CI_STATUS_FLAKY_DOWNGRADE)
+	if flakyDowngrade != "" {
+		c.FlakyDowngrade, err = strconv.ParseBool(flakyDowngrade)
+		if err != nil {
+			return c, errors.Wrapf(err, "%s environment variable is invalid", CI_STATUS_FLAKY_DOWNGRADE)
+		}
+	}
+
+	flakyThreshold := os.Getenv(CI_STATUS_FLAKY_THRESHOLD)
+	if flakyThreshold != "" {
+		c.FlakyThreshold, err = strconv.ParseFloat(flakyThreshold, 64)
+		if err != nil || c.FlakyThreshold <= 0 || c.FlakyThreshold > 1 {
+			return c, errors.Errorf("%s environment variable must be a number between 0 and 1", CI_STATUS_FLAKY_THRESHOLD)
+		}
+	}
+
+	quietHours, quietDays := os.Getenv(CI_STATUS_QUIET_HOURS), os.Getenv(CI_STATUS_QUIET_DAYS)
+	if quietHours != "" || quietDays != "" {
+		c.QuietHours, err = cistatus.ParseQuietHours(quietHours, quietDays, os.Getenv(CI_STATUS_QUIET_TIMEZONE))
+		if err != nil {
+			return c, errors.Wrap(err, "quiet hours environment variables are invalid")
+		}
+	}
+
+	err = c.notifyFromEnv()
+	if err != nil {
+		return c, err
+	}
+
 	c.JWTAlgorithm = os.Getenv(CI_STATUS_HTTP_SERVER_JWT_ALGORITHM)
 	if c.JWTAlgorithm == "" {
 		c.JWTAlgorithm = CI_STATUS_HTTP_SERVER_JWT_ALGORITHM_DEFAULT
@@ -86,9 +304,146 @@ func configFromEnv() (config, error) {
 	return c, nil
 }
 
-func (c config) NewServer() *cistatus.Server {
-	fetcher := gitlab.NewClient(c.GitLabBaseURL, c.GitLabAPIToken)
-	server := cistatus.NewServer(fetcher, c.GitLabRefreshInterval)
+// cctrayFromEnv reads the cctray configuration. urls is a comma separated
+// list of cc.xml URLs.
+func (c *config) cctrayFromEnv(urls string) error {
+	for _, u := range strings.Split(urls, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+
+		feed, err := cctray.NewFeed(u)
+		if err != nil {
+			return errors.Wrapf(err, "%s environment variable is invalid", CCTRAY_URLS)
+		}
+		c.CCTrayFeeds = append(c.CCTrayFeeds, feed)
+	}
+
+	if len(c.CCTrayFeeds) == 0 {
+		return errors.Errorf("%s environment variable is invalid: no URLs", CCTRAY_URLS)
+	}
+
+	c.CCTrayUsername = os.Getenv(CCTRAY_USERNAME)
+	c.CCTrayPassword = os.Getenv(CCTRAY_PASSWORD)
+
+	pattern := os.Getenv(CCTRAY_NAME_PATTERN)
+	if pattern == "" {
+		pattern = cctray.DefaultNamePattern
+	}
+
+	var err error
+	c.CCTrayNamePattern, err = regexp.Compile(pattern)
+	if err != nil {
+		return errors.Wrapf(err, "%s environment variable is invalid", CCTRAY_NAME_PATTERN)
+	}
+
+	return nil
+}
+
+// relayFromEnv reads the relay configuration. upstreams is a comma
+// separated list of zone=URL pairs.
+func (c *config) relayFromEnv(upstreams string) error {
+	var tlsConfig *tls.Config
+	caFile := os.Getenv(CI_STATUS_RELAY_CA_FILE)
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return errors.Wrapf(err, "%s environment variable is invalid", CI_STATUS_RELAY_CA_FILE)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("%s environment variable is invalid: no certificates found", CI_STATUS_RELAY_CA_FILE)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+
+	token := os.Getenv(CI_STATUS_RELAY_TOKEN)
+
+	for _, pair := range strings.Split(upstreams, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("%s environment variable is invalid: expected zone=URL, got %q", CI_STATUS_RELAY_UPSTREAMS, pair)
+		}
+
+		upstream, err := relay.NewUpstream(parts[0], parts[1])
+		if err != nil {
+			return errors.Wrapf(err, "%s environment variable is invalid", CI_STATUS_RELAY_UPSTREAMS)
+		}
+
+		if upstream.Client.Token == "" {
+			upstream.Client.Token = token
+		}
+		upstream.Client.TLSConfig = tlsConfig
+
+		c.RelayUpstreams = append(c.RelayUpstreams, upstream)
+	}
+
+	if len(c.RelayUpstreams) == 0 {
+		return errors.Errorf("%s environment variable is invalid: no upstreams", CI_STATUS_RELAY_UPSTREAMS)
+	}
+
+	return nil
+}
+
+// envFallback returns the name and value of the first of the environment
+// variables that is set
+func envFallback(names ...string) (string, string) {
+	for _, name := range names {
+		value := os.Getenv(name)
+		if value != "" {
+			return name, value
+		}
+	}
+
+	return names[0], ""
+}
+
+// fetcher returns the Fetcher for the configured CI server
+func (c config) fetcher() cistatus.Fetcher {
+	if len(c.CCTrayFeeds) > 0 {
+		client := cctray.NewClient(c.CCTrayFeeds...)
+		client.Username = c.CCTrayUsername
+		client.Password = c.CCTrayPassword
+		client.NamePattern = c.CCTrayNamePattern
+		return client
+	}
+
+	if c.FilePath != "" {
+		return file.NewClient(c.FilePath)
+	}
+
+	if len(c.RelayUpstreams) > 0 {
+		return relay.NewRelay(c.RelayUpstreams...)
+	}
+
+	if len(c.ExecCommand) > 0 {
+		client := exec.NewClient(c.ExecCommand[0], c.ExecCommand[1:]...)
+		client.Dir = c.ExecDir
+		client.Env = c.ExecEnv
+		return client
+	}
+
+	return gitlab.NewClient(c.GitLabBaseURL, c.GitLabAPIToken)
+}
+
+func (c config) NewServer() (*cistatus.Server, error) {
+	server := cistatus.NewServer(c.fetcher(), c.RefreshInterval)
+	server.Addr = c.HTTPAddress
+	server.FetchTimeout = c.FetchTimeout
+	server.ReadyIntervals = c.ReadyIntervals
+	server.StatePath = c.StateFile
+	server.FlakyDowngrade = c.FlakyDowngrade
+	server.FlakyThreshold = c.FlakyThreshold
+	server.Subscriptions = c.Subscriptions
+	server.StillFailingAfter = c.StillFailingAfter
+	server.QuietHours = c.QuietHours
 
 	if c.Verbose {
 		server.Logger = log.New(os.Stdout, "", log.LstdFlags)
@@ -98,5 +453,24 @@ func (c config) NewServer() *cistatus.Server {
 	server.JWT.Algorithm = c.JWTAlgorithm
 	server.JWT.Secret = c.JWTSecret
 
-	return server
+	// Webhook setup
+	if c.GitLabWebhookSecret != "" {
+		server.Handle("/hooks/gitlab", gitlab.NewHookHandler(server, c.GitLabWebhookSecret))
+	}
+	if c.GitHubWebhookSecret != "" {
+		server.Handle("/hooks/github", github.NewHookHandler(server, c.GitHubWebhookSecret))
+	}
+
+	// History setup
+	if c.HistoryDir != "" {
+		history, err := cistatus.OpenHistory(c.HistoryDir)
+		if err != nil {
+			return nil, err
+		}
+		history.Retention = c.HistoryRetention
+		history.MaxBytes = c.HistoryMaxBytes
+		server.History = history
+	}
+
+	return server, nil
 }
@@ -1,14 +1,35 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
+const shutdownTimeout = 15 * time.Second
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		err := report(os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Printf("Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		err := token(os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Printf("Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	config, err := configFromEnv()
 	if err != nil {
 		log.Printf("Error: %s\n", err.Error())
@@ -16,15 +37,49 @@ func main() {
 		os.Exit(1)
 	}
 
-	server := config.NewServer()
-	err = http.ListenAndServe(config.HTTPAddress, server)
+	server, err := config.NewServer()
+	if err != nil {
+		log.Printf("Error: %s\n", err.Error())
+		log.Println("Exiting")
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		sig := <-exitChan()
+		log.Printf("Received signal: %v\n", sig)
+		cancel()
+	}()
+
+	exitCode := 0
+	err = server.Run(ctx)
 	if err != nil {
 		log.Println(err)
+		exitCode = 1
+	}
+
+	log.Println("Shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("Error shutting down: %s\n", err)
+		exitCode = 1
+	}
+
+	if server.History != nil {
+		err = server.History.Close()
+		if err != nil {
+			log.Printf("Error closing history: %s\n", err)
+			exitCode = 1
+		}
 	}
 
-	sig := <-exitChan()
-	log.Printf("Received signal: %v\n", sig)
 	log.Println("Exiting")
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
 }
 
 func exitChan() chan os.Signal {
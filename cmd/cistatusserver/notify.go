@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"tantalic.com/cistatus"
+	"tantalic.com/cistatus/notify"
+)
+
+const (
+	CI_STATUS_NOTIFY_SLACK_URL      = "CI_STATUS_NOTIFY_SLACK_URL"
+	CI_STATUS_NOTIFY_SLACK_CHANNEL  = "CI_STATUS_NOTIFY_SLACK_CHANNEL"
+	CI_STATUS_NOTIFY_SLACK_USERNAME = "CI_STATUS_NOTIFY_SLACK_USERNAME"
+
+	// The template is the body of the requests, the notification as JSON
+	// when empty. The token is sent as a bearer token.
+	CI_STATUS_NOTIFY_WEBHOOK_URL      = "CI_STATUS_NOTIFY_WEBHOOK_URL"
+	CI_STATUS_NOTIFY_WEBHOOK_TEMPLATE = "CI_STATUS_NOTIFY_WEBHOOK_TEMPLATE"
+	CI_STATUS_NOTIFY_WEBHOOK_TOKEN    = "CI_STATUS_NOTIFY_WEBHOOK_TOKEN"
+
+	// The recipients are a comma separated list of addresses
+	CI_STATUS_NOTIFY_SMTP_ADDR     = "CI_STATUS_NOTIFY_SMTP_ADDR"
+	CI_STATUS_NOTIFY_SMTP_USERNAME = "CI_STATUS_NOTIFY_SMTP_USERNAME"
+	CI_STATUS_NOTIFY_SMTP_PASSWORD = "CI_STATUS_NOTIFY_SMTP_PASSWORD"
+	CI_STATUS_NOTIFY_SMTP_FROM     = "CI_STATUS_NOTIFY_SMTP_FROM"
+	CI_STATUS_NOTIFY_SMTP_TO       = "CI_STATUS_NOTIFY_SMTP_TO"
+
+	// Each notifier is configured further by appending these suffixes to
+	// its prefix, such as CI_STATUS_NOTIFY_SLACK_PROJECTS. Projects,
+	// branches and events are comma separated lists, the rate limit is a
+	// number of notifications per period such as 10/1h. The dry run
+	// variable without a prefix applies to every notifier.
+	NOTIFY_PROJECTS   = "PROJECTS"
+	NOTIFY_BRANCHES   = "BRANCHES"
+	NOTIFY_EVENTS     = "EVENTS"
+	NOTIFY_RATE_LIMIT = "RATE_LIMIT"
+	NOTIFY_DRY_RUN    = "DRY_RUN"
+
+	CI_STATUS_NOTIFY_DRY_RUN             = "CI_STATUS_NOTIFY_DRY_RUN"
+	CI_STATUS_NOTIFY_STILL_FAILING_AFTER = "CI_STATUS_NOTIFY_STILL_FAILING_AFTER"
+)
+
+// notifyFromEnv reads the notifier configuration
+func (c *config) notifyFromEnv() error {
+	var err error
+
+	stillFailingAfter := os.Getenv(CI_STATUS_NOTIFY_STILL_FAILING_AFTER)
+	if stillFailingAfter != "" {
+		c.StillFailingAfter, err = time.ParseDuration(stillFailingAfter)
+		if err != nil || c.StillFailingAfter <= 0 {
+			return errors.Errorf("%s environment variable must be a positive duration", CI_STATUS_NOTIFY_STILL_FAILING_AFTER)
+		}
+	}
+
+	dryRun := false
+	if value := os.Getenv(CI_STATUS_NOTIFY_DRY_RUN); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			return errors.Wrapf(err, "%s environment variable is invalid", CI_STATUS_NOTIFY_DRY_RUN)
+		}
+	}
+
+	if url := os.Getenv(CI_STATUS_NOTIFY_SLACK_URL); url != "" {
+		slack := notify.NewSlack(url)
+		slack.Channel = os.Getenv(CI_STATUS_NOTIFY_SLACK_CHANNEL)
+		slack.Username = os.Getenv(CI_STATUS_NOTIFY_SLACK_USERNAME)
+
+		err := c.addSubscription("slack", "CI_STATUS_NOTIFY_SLACK_", slack, dryRun)
+		if err != nil {
+			return err
+		}
+	}
+
+	if url := os.Getenv(CI_STATUS_NOTIFY_WEBHOOK_URL); url != "" {
+		webhook := notify.NewWebhook(url)
+		if text := os.Getenv(CI_STATUS_NOTIFY_WEBHOOK_TEMPLATE); text != "" {
+			webhook.Template, err = notify.ParseTemplate(text)
+			if err != nil {
+				return errors.Wrapf(err, "%s environment variable is invalid", CI_STATUS_NOTIFY_WEBHOOK_TEMPLATE)
+			}
+		}
+		if token := os.Getenv(CI_STATUS_NOTIFY_WEBHOOK_TOKEN); token != "" {
+			webhook.Header = http.Header{"Authorization": {"Bearer " + token}}
+		}
+
+		err := c.addSubscription("webhook", "CI_STATUS_NOTIFY_WEBHOOK_", webhook, dryRun)
+		if err != nil {
+			return err
+		}
+	}
+
+	if addr := os.Getenv(CI_STATUS_NOTIFY_SMTP_ADDR); addr != "" {
+		from := os.Getenv(CI_STATUS_NOTIFY_SMTP_FROM)
+		if from == "" {
+			return errors.Errorf("%s environment variable is required", CI_STATUS_NOTIFY_SMTP_FROM)
+		}
+
+		to := splitList(os.Getenv(CI_STATUS_NOTIFY_SMTP_TO))
+		if len(to) == 0 {
+			return errors.Errorf("%s environment variable is required", CI_STATUS_NOTIFY_SMTP_TO)
+		}
+
+		mail := notify.NewSMTP(addr, from, to...)
+		mail.Username = os.Getenv(CI_STATUS_NOTIFY_SMTP_USERNAME)
+		mail.Password = os.Getenv(CI_STATUS_NOTIFY_SMTP_PASSWORD)
+
+		err := c.addSubscription("smtp", "CI_STATUS_NOTIFY_SMTP_", mail, dryRun)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addSubscription subscribes notifier with the filters, rate limit and dry
+// run mode read from the environment variables starting with prefix
+func (c *config) addSubscription(name, prefix string, notifier cistatus.Notifier, dryRun bool) error {
+	sub := &cistatus.Subscription{
+		Name:     name,
+		Notifier: notifier,
+		Projects: listSet(os.Getenv(prefix + NOTIFY_PROJECTS)),
+		Branches: listSet(os.Getenv(prefix + NOTIFY_BRANCHES)),
+		Events:   listSet(os.Getenv(prefix + NOTIFY_EVENTS)),
+		DryRun:   dryRun,
+	}
+
+	for event := range sub.Events {
+		if event != cistatus.BrokenEvent && event != cistatus.FixedEvent && event != cistatus.StillFailingEvent {
+			return errors.Errorf("%s environment variable is invalid: unknown event %q", prefix+NOTIFY_EVENTS, event)
+		}
+	}
+
+	if rateLimit := os.Getenv(prefix + NOTIFY_RATE_LIMIT); rateLimit != "" {
+		parts := strings.SplitN(rateLimit, "/", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("%s environment variable is invalid: expected count/period, got %q", prefix+NOTIFY_RATE_LIMIT, rateLimit)
+		}
+
+		var err error
+		sub.RateLimit, err = strconv.Atoi(parts[0])
+		if err == nil {
+			sub.RatePeriod, err = time.ParseDuration(parts[1])
+		}
+		if err != nil || sub.RateLimit <= 0 || sub.RatePeriod <= 0 {
+			return errors.Errorf("%s environment variable is invalid: expected count/period, got %q", prefix+NOTIFY_RATE_LIMIT, rateLimit)
+		}
+	}
+
+	if value := os.Getenv(prefix + NOTIFY_DRY_RUN); value != "" {
+		var err error
+		sub.DryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			return errors.Wrapf(err, "%s environment variable is invalid", prefix+NOTIFY_DRY_RUN)
+		}
+	}
+
+	c.Subscriptions = append(c.Subscriptions, sub)
+	return nil
+}
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listSet returns the items of a comma separated list as a set, or nil when
+// there are none
+func listSet(value string) map[string]bool {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool)
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"tantalic.com/cistatus"
+)
+
+// report prints the reliability statistics of the history kept in
+// CI_STATUS_HISTORY_DIR as text or JSON. It is run with:
+//
+//	cistatusserver report [-json] [-window 168h] [-until 2017-06-05T00:00:00Z]
+func report(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	window := flags.Duration("window", cistatus.DefaultStatsWindow, "period covered by the report")
+	untilValue := flags.String("until", "", "end of the period as an RFC3339 time (default now)")
+	err := flags.Parse(args)
+	if err == flag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dir := os.Getenv(CI_STATUS_HISTORY_DIR)
+	if dir == "" {
+		return errors.Errorf("%s environment variable is required", CI_STATUS_HISTORY_DIR)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return errors.Wrap(err, "unable to read history")
+	}
+
+	until := time.Now()
+	if *untilValue != "" {
+		until, err = time.Parse(time.RFC3339, *untilValue)
+		if err != nil {
+			return errors.Wrap(err, "invalid until")
+		}
+	}
+
+	history, err := cistatus.OpenHistory(dir)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	stats, err := history.Stats(until.Add(-*window), until, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+
+	return writeReport(out, stats)
+}
+
+// writeReport writes stats as a text table
+func writeReport(out io.Writer, stats cistatus.Stats) error {
+	const timeLayout = "2006-01-02 15:04 MST"
+
+	fmt.Fprintf(out, "Build report from %s to %s\n\n", stats.Since.Format(timeLayout), stats.Until.Format(timeLayout))
+	fmt.Fprintf(out, "Overall: %s green, %s yellow, %s red, %d breakages, MTTR %s, longest red %s\n\n",
+		percent(stats.Overall.TimeGreen),
+		percent(stats.Overall.TimeYellow),
+		percent(stats.Overall.TimeRed),
+		stats.Overall.Breakages,
+		seconds(stats.Overall.MeanTimeToRecoverySeconds),
+		seconds(stats.Overall.LongestRedSeconds),
+	)
+
+	if len(stats.Branches) == 0 {
+		fmt.Fprintln(out, "No builds recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tBRANCH\tRUNS\tPASS RATE\tBREAKAGES\tMTTR\tLONGEST RED\tGREEN\tYELLOW\tRED\tMEDIAN JOB")
+	for _, branch := range stats.Branches {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			branch.Project,
+			branch.Branch,
+			branch.Runs,
+			percent(branch.PassRate),
+			branch.Breakages,
+			seconds(branch.MeanTimeToRecoverySeconds),
+			seconds(branch.LongestRedSeconds),
+			percent(branch.TimeGreen),
+			percent(branch.TimeYellow),
+			percent(branch.TimeRed),
+			seconds(branch.MedianJobSeconds),
+		)
+	}
+
+	return w.Flush()
+}
+
+func percent(fraction float64) string {
+	return fmt.Sprintf("%.1f%%", fraction*100)
+}
+
+func seconds(s float64) string {
+	if s == 0 {
+		return "-"
+	}
+	return (time.Duration(s) * time.Second).String()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"tantalic.com/cistatus"
+)
+
+// defaultFeedTokenTTL is how long feed tokens are valid by default
+const defaultFeedTokenTTL = 30 * 24 * time.Hour
+
+// token prints a feed token, which authorizes the badges and cc.xml in the
+// token query parameter but not the API. It is signed with the
+// CI_STATUS_HTTP_SERVER_JWT_* configuration and run with:
+//
+//	cistatusserver token [-ttl 720h]
+func token(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	ttl := flags.Duration("ttl", defaultFeedTokenTTL, "time until the token expires")
+	err := flags.Parse(args)
+	if err == flag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if *ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	secret := os.Getenv(CI_STATUS_HTTP_SERVER_JWT_SECRET)
+	if secret == "" {
+		return errors.Errorf("%s environment variable is required", CI_STATUS_HTTP_SERVER_JWT_SECRET)
+	}
+
+	algorithm := os.Getenv(CI_STATUS_HTTP_SERVER_JWT_ALGORITHM)
+	if algorithm == "" {
+		algorithm = CI_STATUS_HTTP_SERVER_JWT_ALGORITHM_DEFAULT
+	}
+
+	t, err := cistatus.FeedToken(algorithm, []byte(secret), *ttl)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, t)
+	return err
+}
@@ -0,0 +1,238 @@
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"tantalic.com/cistatus"
+)
+
+// maxErrorOutput is the most of the command's standard error included in a
+// fetch error
+const maxErrorOutput = 512
+
+// validStates are the states accepted in the line format. They match the
+// GitLab status names used throughout cistatus.
+var validStates = map[string]bool{
+	"created":  true,
+	"pending":  true,
+	"running":  true,
+	"success":  true,
+	"failed":   true,
+	"canceled": true,
+	"skipped":  true,
+	"manual":   true,
+	"unknown":  true,
+}
+
+type Client struct {
+	Command string
+	Args    []string
+
+	// Env holds additional environment variables, in the form
+	// "KEY=value", for the command. The command also inherits the
+	// environment of the server.
+	Env []string
+
+	// Dir is the working directory of the command. If empty the command
+	// runs in the working directory of the server.
+	Dir string
+
+	// Timeout limits how long the command may run. The command is also
+	// stopped when the context passed to FetchStatus is done.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	previous []cistatus.Project
+}
+
+// NewClient creates a client that runs command with args to fetch the CI
+// status
+func NewClient(command string, args ...string) *Client {
+	return &Client{
+		Command: command,
+		Args:    args,
+	}
+}
+
+// FetchStatus runs the command and parses its standard output. The output
+// is either JSON, a single project or a list of projects, or the line
+// format:
+//
+//	# comments and blank lines are ignored
+//	<project> <branch> <job> <state> [<commit> [<author>]]
+//
+// Statuses in the line format are created when first seen in their state
+// with their commit and keep that time for as long as they stay the same.
+// A non-zero exit status or invalid output fails the fetch.
+func (c *Client) FetchStatus(ctx context.Context) ([]cistatus.Project, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	cmd := osexec.CommandContext(ctx, c.Command, c.Args...)
+	cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := cmd.Start()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to run %s", c.Command)
+	}
+
+	// Wait does not return until every process holding the output open has
+	// exited, which may be after the command itself is killed
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "%s did not finish after %s", c.Command, time.Since(start))
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(ctx.Err(), "%s did not finish after %s", c.Command, time.Since(start))
+		}
+
+		output := lastOutput(stderr.Bytes())
+		if output != "" {
+			return nil, errors.Wrapf(err, "%s failed: %s", c.Command, output)
+		}
+		return nil, errors.Wrapf(err, "%s failed", c.Command)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	projects, err := parseOutput(stdout.Bytes(), time.Now(), c.previous)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid output from %s", c.Command)
+	}
+	c.previous = projects
+
+	return projects, nil
+}
+
+// lastOutput returns the end of the output, which is most likely to
+// explain a failure
+func lastOutput(output []byte) string {
+	s := strings.TrimSpace(string(output))
+	if len(s) > maxErrorOutput {
+		s = "..." + s[len(s)-maxErrorOutput:]
+	}
+
+	return s
+}
+
+// parseOutput parses JSON or line format output. Statuses in the line
+// format are created at now unless they are unchanged from previous.
+func parseOutput(output []byte, now time.Time, previous []cistatus.Project) ([]cistatus.Project, error) {
+	trimmed := bytes.TrimSpace(output)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var project cistatus.Project
+		err := json.Unmarshal(trimmed, &project)
+		if err != nil {
+			return nil, err
+		}
+		return []cistatus.Project{project}, nil
+
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var projects []cistatus.Project
+		err := json.Unmarshal(trimmed, &projects)
+		return projects, err
+	}
+
+	return parseLines(output, now, previous)
+}
+
+func parseLines(output []byte, now time.Time, previous []cistatus.Project) ([]cistatus.Project, error) {
+	var projects []cistatus.Project
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 4 || len(fields) > 6 {
+			return nil, errors.Errorf("line %d: expected <project> <branch> <job> <state> [<commit> [<author>]]", line)
+		}
+
+		if !validStates[fields[3]] {
+			return nil, errors.Errorf("line %d: invalid state %q", line, fields[3])
+		}
+
+		branch := cistatus.Branch{
+			Name: fields[1],
+		}
+		if len(fields) > 4 {
+			branch.Commit = fields[4]
+		}
+
+		status := cistatus.Status{
+			Name:    fields[2],
+			Status:  fields[3],
+			Created: created(previous, fields[0], branch.Name, branch.Commit, fields[2], fields[3], now),
+		}
+		if len(fields) > 5 {
+			status.Author = fields[5]
+		}
+
+		projects = cistatus.AddStatus(projects, fields[0], branch, status)
+	}
+
+	return projects, scanner.Err()
+}
+
+// created returns when a status was first seen in state with commit, now
+// unless it is in previous. Keeping the time stable lets unchanged output
+// compare equal across polls.
+func created(previous []cistatus.Project, project, branch, commit, job, state string, now time.Time) time.Time {
+	for _, p := range previous {
+		if p.Name != project {
+			continue
+		}
+
+		for _, b := range p.Branches {
+			if b.Name != branch || b.Commit != commit {
+				continue
+			}
+
+			for _, status := range b.Statuses {
+				if status.Name == job && status.Status == state {
+					return status.Created
+				}
+			}
+		}
+	}
+
+	return now
+}
@@ -0,0 +1,151 @@
+package exec
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tantalic.com/cistatus"
+)
+
+func TestParseLines(t *testing.T) {
+	now := time.Date(2017, 4, 11, 20, 0, 0, 0, time.UTC)
+	output := `
+# project branch job state commit author
+api master build success abc123 alice
+api master test  failed  abc123
+api develop build running
+
+web master deploy pending
+`
+
+	projects, err := parseOutput([]byte(output), now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []cistatus.Project{
+		{Name: "api", Branches: []cistatus.Branch{
+			{Name: "master", Commit: "abc123", Statuses: []cistatus.Status{
+				{Name: "build", Status: "success", Created: now, Author: "alice"},
+				{Name: "test", Status: "failed", Created: now},
+			}},
+			{Name: "develop", Statuses: []cistatus.Status{{Name: "build", Status: "running", Created: now}}},
+		}},
+		{Name: "web", Branches: []cistatus.Branch{
+			{Name: "master", Statuses: []cistatus.Status{{Name: "deploy", Status: "pending", Created: now}}},
+		}},
+	}
+	if !reflect.DeepEqual(projects, want) {
+		t.Errorf("got %+v, want %+v", projects, want)
+	}
+}
+
+func TestParseLinesInvalid(t *testing.T) {
+	for _, output := range []string{
+		"api master build\n",
+		"api master build success abc123 alice extra\n",
+		"api master build broken\n",
+	} {
+		_, err := parseOutput([]byte(output), time.Now(), nil)
+		if err == nil {
+			t.Errorf("%q: expected an error", output)
+		}
+	}
+}
+
+func TestParseLinesKeepsCreated(t *testing.T) {
+	first := time.Date(2017, 4, 11, 20, 0, 0, 0, time.UTC)
+	output := []byte("api master build success abc123\napi master test running abc123\n")
+
+	previous, err := parseOutput(output, first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same output parsed again is equal, so that an unchanged poll is
+	// not taken as a change
+	again, err := parseOutput(output, first.Add(time.Minute), previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, previous) {
+		t.Errorf("unchanged output parsed differently: %+v, want %+v", again, previous)
+	}
+
+	later := first.Add(2 * time.Minute)
+	changed, err := parseOutput([]byte("api master build success def456\napi master test failed def456\n"), later, again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range changed[0].Branches[0].Statuses {
+		if !status.Created.Equal(later) {
+			t.Errorf("%s: created %s, want %s for a new commit", status.Name, status.Created, later)
+		}
+	}
+
+	finished, err := parseOutput([]byte("api master build success def456\napi master test success def456\n"), later.Add(time.Minute), changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := finished[0].Branches[0].Statuses
+	if !statuses[0].Created.Equal(later) || !statuses[1].Created.Equal(later.Add(time.Minute)) {
+		t.Errorf("unexpected created times %+v", statuses)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	project := `{"name": "api", "branches": [{"name": "master", "statuses": [{"name": "test", "status": "success"}]}]}`
+
+	for _, output := range []string{project, "[" + project + "]"} {
+		projects, err := parseOutput([]byte(output), time.Now(), nil)
+		if err != nil {
+			t.Errorf("%s: %s", output, err)
+			continue
+		}
+		if len(projects) != 1 || projects[0].Name != "api" || projects[0].Branches[0].Statuses[0].Status != "success" {
+			t.Errorf("%s: unexpected projects %+v", output, projects)
+		}
+	}
+}
+
+func TestFetchStatus(t *testing.T) {
+	client := NewClient("sh", "-c", "echo api master test success abc123")
+
+	first, err := client.FetchStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.FetchStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("unchanged output fetched differently: %+v, %+v", first, second)
+	}
+}
+
+func TestFetchStatusFailure(t *testing.T) {
+	client := NewClient("sh", "-c", "echo unable to reach CI >&2; exit 3")
+
+	_, err := client.FetchStatus(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unable to reach CI") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestFetchStatusTimeout(t *testing.T) {
+	client := NewClient("sleep", "10")
+	client.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := client.FetchStatus(context.Background())
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+}
@@ -0,0 +1,250 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"tantalic.com/cistatus"
+)
+
+// DefaultWatchInterval is how often the files are checked for changes
+const DefaultWatchInterval = time.Second
+
+type Client struct {
+	// Path is a file containing a list of projects or a directory tree of
+	// files each containing a single project (or a list of projects).
+	// Files may be JSON (.json) or YAML (.yaml or .yml).
+	Path string
+
+	// WatchInterval is how often the files are checked for changes
+	WatchInterval time.Duration
+}
+
+// NewClient creates a client that reads the CI status from the file or
+// directory at path
+func NewClient(path string) *Client {
+	return &Client{
+		Path:          path,
+		WatchInterval: DefaultWatchInterval,
+	}
+}
+
+// FetchStatus reads the projects from the file or every JSON and YAML file
+// in the directory tree. Projects read from a directory without a name are
+// named after the file, relative to the directory and without extension.
+func (c *Client) FetchStatus(ctx context.Context) ([]cistatus.Project, error) {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read status")
+	}
+
+	if !info.IsDir() {
+		return readFile(c.Path)
+	}
+
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []cistatus.Project
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		projects, err := readFile(file.path)
+		if err != nil {
+			return results, err
+		}
+
+		for _, project := range projects {
+			if project.Name == "" {
+				name, _ := filepath.Rel(c.Path, file.path)
+				project.Name = strings.TrimSuffix(filepath.ToSlash(name), filepath.Ext(name))
+			}
+			results = append(results, project)
+		}
+	}
+
+	return results, nil
+}
+
+// Watch checks the files for changes every WatchInterval. A value is sent
+// whenever a file is added, removed or modified.
+func (c *Client) Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	interval := c.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := c.fingerprint()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current := c.fingerprint()
+			if current == last {
+				continue
+			}
+			last = current
+
+			select {
+			case changes <- struct{}{}:
+			default:
+				// A change is already waiting to be fetched
+			}
+		}
+	}()
+
+	return changes
+}
+
+type statusFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files returns the JSON and YAML files in the directory tree, ordered by
+// path. Hidden files and directories are skipped.
+func (c *Client) files() ([]statusFile, error) {
+	var files []statusFile
+
+	err := filepath.Walk(c.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		hidden := strings.HasPrefix(info.Name(), ".") && path != c.Path
+		if info.IsDir() {
+			if hidden {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if hidden || formatOf(path) == "" {
+			return nil
+		}
+
+		files = append(files, statusFile{
+			path:    path,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read status directory")
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+
+	return files, nil
+}
+
+// fingerprint summarizes the names, sizes and modification times of the
+// files so changes can be detected
+func (c *Client) fingerprint() string {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+
+	files := []statusFile{{
+		path:    c.Path,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}}
+
+	if info.IsDir() {
+		files, err = c.files()
+		if err != nil {
+			return "error: " + err.Error()
+		}
+	}
+
+	var b bytes.Buffer
+	for _, file := range files {
+		fmt.Fprintf(&b, "%s\x00%d\x00%d\n", file.path, file.modTime.UnixNano(), file.size)
+	}
+
+	return b.String()
+}
+
+// formatOf returns the format of the file based on its extension, or an
+// empty string when it is neither JSON nor YAML
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+
+	return ""
+}
+
+// readFile reads a project or list of projects from the file. Files with an
+// unrecognized extension are read as JSON.
+func readFile(path string) ([]cistatus.Project, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read status")
+	}
+
+	if formatOf(path) == "yaml" {
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid YAML in %s", path)
+		}
+	}
+
+	projects, err := decodeProjects(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid status in %s", path)
+	}
+
+	return projects, nil
+}
+
+// decodeProjects decodes either a single project or a list of projects
+func decodeProjects(data []byte) ([]cistatus.Project, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		var project cistatus.Project
+		err := json.Unmarshal(data, &project)
+		if err != nil {
+			return nil, err
+		}
+		return []cistatus.Project{project}, nil
+	}
+
+	var projects []cistatus.Project
+	err := json.Unmarshal(data, &projects)
+	return projects, err
+}
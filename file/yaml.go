@@ -0,0 +1,65 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// yamlToJSON converts a YAML document to JSON so it can be decoded with the
+// encoding/json struct tags. Numbers, booleans and timestamps keep their
+// types so they can be decoded into the non-string fields of a project.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse YAML")
+	}
+
+	value, err := jsonValue(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+// jsonValue converts the mappings decoded by yaml, whose keys may be of any
+// type, to mappings with string keys that encoding/json can encode
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			converted, err := jsonValue(value)
+			if err != nil {
+				return nil, err
+			}
+
+			switch key := key.(type) {
+			case string:
+				m[key] = converted
+			case int, int64, uint64, float64, bool:
+				m[fmt.Sprint(key)] = converted
+			default:
+				return nil, errors.Errorf("unsupported YAML mapping key %v", key)
+			}
+		}
+		return m, nil
+
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			converted, err := jsonValue(value)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = converted
+		}
+		return s, nil
+	}
+
+	return v, nil
+}
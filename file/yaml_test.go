@@ -0,0 +1,133 @@
+package file
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want interface{}
+	}{
+		{
+			name: "block mapping and sequence",
+			yaml: "name: api\nbranches:\n  - name: master\n  - name: develop\n",
+			want: map[string]interface{}{
+				"name": "api",
+				"branches": []interface{}{
+					map[string]interface{}{"name": "master"},
+					map[string]interface{}{"name": "develop"},
+				},
+			},
+		},
+		{
+			name: "typed scalars",
+			yaml: "int: 1\nfloat: 0.3\nbool: true\nnone: ~\nstring: abc\n",
+			want: map[string]interface{}{
+				"int":    float64(1),
+				"float":  0.3,
+				"bool":   true,
+				"none":   nil,
+				"string": "abc",
+			},
+		},
+		{
+			name: "quoted scalars stay strings",
+			yaml: "int: \"1\"\nbool: 'true'\n",
+			want: map[string]interface{}{"int": "1", "bool": "true"},
+		},
+		{
+			name: "flow sequence with quoted commas",
+			yaml: "jobs: [build, \"lint, vet\", 'test']\n",
+			want: map[string]interface{}{"jobs": []interface{}{"build", "lint, vet", "test"}},
+		},
+		{
+			name: "comments and document marker",
+			yaml: "---\n# a project\nname: api # the name\n",
+			want: map[string]interface{}{"name": "api"},
+		},
+		{
+			name: "non-string keys",
+			yaml: "1: one\ntrue: yes\n",
+			want: map[string]interface{}{"1": "one", "true": true},
+		},
+		{
+			name: "empty document",
+			yaml: "",
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		data, err := yamlToJSON([]byte(test.yaml))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+
+		var got interface{}
+		err = json.Unmarshal(data, &got)
+		if err != nil {
+			t.Errorf("%s: invalid JSON %s: %s", test.name, data, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestYAMLToJSONInvalid(t *testing.T) {
+	for _, doc := range []string{
+		"name: [unterminated\n",
+		"name: api\n\tbranches: []\n",
+		"? [a, b]\n: c\n",
+	} {
+		_, err := yamlToJSON([]byte(doc))
+		if err == nil {
+			t.Errorf("%q: expected an error", doc)
+		}
+	}
+}
+
+func TestYAMLProjects(t *testing.T) {
+	doc := `
+- name: api
+  url: https://ci.example.com/api
+  branches:
+    - name: master
+      commit: 0123abcd
+      statuses:
+        - name: test
+          status: failed
+          author: alice
+          created: 2017-04-11T20:03:51Z
+          flakiness: 0.25
+`
+	data, err := yamlToJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projects, err := decodeProjects(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(projects) != 1 || len(projects[0].Branches) != 1 || len(projects[0].Branches[0].Statuses) != 1 {
+		t.Fatalf("unexpected projects %+v", projects)
+	}
+
+	status := projects[0].Branches[0].Statuses[0]
+	if status.Status != "failed" || status.Author != "alice" || status.Flakiness != 0.25 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if want := time.Date(2017, 4, 11, 20, 3, 51, 0, time.UTC); !status.Created.Equal(want) {
+		t.Errorf("created %s, want %s", status.Created, want)
+	}
+}
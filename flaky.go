@@ -0,0 +1,254 @@
+package cistatus
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultFlakyThreshold is the flakiness from which a job is considered
+	// flaky by default
+	DefaultFlakyThreshold = 0.1
+
+	// flakyWindow is the number of most recent runs of a job the flakiness
+	// is computed from
+	flakyWindow = 20
+)
+
+// FlakyJob describes how often a job failed and then passed on retry with
+// the same commit. Flakiness is the fraction of the most recent runs that
+// were such a flip.
+type FlakyJob struct {
+	Project   string     `json:"project"`
+	Job       string     `json:"job"`
+	Flakiness float64    `json:"flakiness"`
+	Runs      int        `json:"runs"`
+	Flips     int        `json:"flips"`
+	LastFlip  *time.Time `json:"lastFlip,omitempty"`
+}
+
+// flakyKey identifies a job across the branches of a project
+type flakyKey struct {
+	project, job string
+}
+
+// flakyRecord is the outcome of the most recent runs of a job, true for a
+// flip
+type flakyRecord struct {
+	Project  string     `json:"project"`
+	Job      string     `json:"job"`
+	Outcomes []bool     `json:"outcomes"`
+	LastFlip *time.Time `json:"lastFlip,omitempty"`
+}
+
+func (r flakyRecord) job() FlakyJob {
+	job := FlakyJob{
+		Project:  r.Project,
+		Job:      r.Job,
+		Runs:     len(r.Outcomes),
+		LastFlip: r.LastFlip,
+	}
+	for _, flip := range r.Outcomes {
+		if flip {
+			job.Flips++
+		}
+	}
+	if job.Runs > 0 {
+		job.Flakiness = float64(job.Flips) / float64(job.Runs)
+	}
+	return job
+}
+
+// flakyDetector detects same-commit fail to pass flips in the statuses
+// seen by the server and remembers the last failed run of every job to mark
+// its retries. It is guarded by the server's mu.
+type flakyDetector struct {
+	runs    map[runKey]bool
+	failed  map[jobKey]failedRun
+	records map[flakyKey]*flakyRecord
+}
+
+// runKey identifies a run of a job in a state. Runs are told apart by their
+// commit and creation time rather than their position among the statuses,
+// as fetchers may report several runs of a job.
+type runKey struct {
+	project, branch, job string
+	commit               string
+	created              int64
+	state                string
+}
+
+// failedRun is the last failed run of a job
+type failedRun struct {
+	commit  string
+	created time.Time
+}
+
+func newFlakyDetector() *flakyDetector {
+	return &flakyDetector{
+		runs:    make(map[runKey]bool),
+		failed:  make(map[jobKey]failedRun),
+		records: make(map[flakyKey]*flakyRecord),
+	}
+}
+
+// observe records a run for every job that finished since the last call. A
+// success of a commit that previously failed the same job is a flip.
+func (d *flakyDetector) observe(now time.Time, projects []Project) {
+	d.observeRuns(now, projects, true)
+}
+
+// observeRuns takes note of the runs of projects that were not seen in the
+// previous call, recording the finished ones when record is set. The
+// failures are remembered across calls so that the retry of a failure is
+// known even once the failed run is no longer reported.
+func (d *flakyDetector) observeRuns(now time.Time, projects []Project, record bool) {
+	runs := make(map[runKey]bool)
+
+	for _, project := range projects {
+		for _, branch := range project.Branches {
+			for _, status := range branch.Statuses {
+				key := runKey{project.Name, branch.Name, status.Name, branch.Commit, status.Created.UnixNano(), status.Status}
+				runs[key] = true
+				if d.runs[key] {
+					continue
+				}
+
+				job := jobKey{project.Name, branch.Name, status.Name}
+				failed, hasFailed := d.failed[job]
+				older := hasFailed && status.Created.Before(failed.created)
+
+				switch status.Status {
+				case "failed":
+					if !older {
+						d.failed[job] = failedRun{branch.Commit, status.Created}
+					}
+					if record {
+						d.record(now, project.Name, status.Name, false)
+					}
+				case "success":
+					if !older {
+						delete(d.failed, job)
+					}
+					if record {
+						d.record(now, project.Name, status.Name, hasFailed && !older && failed.commit == branch.Commit)
+					}
+				}
+			}
+		}
+	}
+
+	d.runs = runs
+}
+
+func (d *flakyDetector) record(now time.Time, project, job string, flip bool) {
+	key := flakyKey{project, job}
+	r := d.records[key]
+	if r == nil {
+		r = &flakyRecord{Project: project, Job: job}
+		d.records[key] = r
+	}
+
+	r.Outcomes = append(r.Outcomes, flip)
+	if len(r.Outcomes) > flakyWindow {
+		r.Outcomes = r.Outcomes[len(r.Outcomes)-flakyWindow:]
+	}
+	if flip {
+		r.LastFlip = &now
+	}
+}
+
+// flakiness returns the flakiness of a job of a project
+func (d *flakyDetector) flakiness(project, job string) float64 {
+	r := d.records[flakyKey{project, job}]
+	if r == nil {
+		return 0
+	}
+	return r.job().Flakiness
+}
+
+// annotate returns a copy of projects with the flakiness of every status,
+// the retries of failed runs marked and, for every branch, the highest
+// flakiness of its statuses
+func (d *flakyDetector) annotate(projects []Project) []Project {
+	annotated := make([]Project, len(projects))
+	for i, project := range projects {
+		annotated[i] = project
+		annotated[i].Branches = make([]Branch, len(project.Branches))
+		for j, branch := range project.Branches {
+			branch.Flakiness = 0
+			branch.Statuses = append([]Status(nil), branch.Statuses...)
+			for k := range branch.Statuses {
+				status := &branch.Statuses[k]
+				status.Retry = d.retry(project.Name, branch, *status)
+
+				flakiness := d.flakiness(project.Name, status.Name)
+				status.Flakiness = flakiness
+				if flakiness > branch.Flakiness {
+					branch.Flakiness = flakiness
+				}
+			}
+			annotated[i].Branches[j] = branch
+		}
+	}
+	return annotated
+}
+
+// retry reports whether status is a pending or running retry of the last
+// failed run of its job
+func (d *flakyDetector) retry(project string, branch Branch, status Status) bool {
+	if status.Status != "pending" && status.Status != "running" {
+		return false
+	}
+
+	failed, ok := d.failed[jobKey{project, branch.Name, status.Name}]
+	return ok && failed.commit == branch.Commit && status.Created.After(failed.created)
+}
+
+// jobs returns the jobs that flipped at least once in their most recent
+// runs, flakiest first
+func (d *flakyDetector) jobs() []FlakyJob {
+	jobs := []FlakyJob{}
+	for _, r := range d.records {
+		job := r.job()
+		if job.Flips > 0 {
+			jobs = append(jobs, job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Flakiness != jobs[j].Flakiness {
+			return jobs[i].Flakiness > jobs[j].Flakiness
+		}
+		if jobs[i].Project != jobs[j].Project {
+			return jobs[i].Project < jobs[j].Project
+		}
+		return jobs[i].Job < jobs[j].Job
+	})
+
+	return jobs
+}
+
+// snapshot returns a copy of the records to save in the state file
+func (d *flakyDetector) snapshot() []flakyRecord {
+	var records []flakyRecord
+	for _, r := range d.records {
+		record := *r
+		record.Outcomes = append([]bool(nil), r.Outcomes...)
+		records = append(records, record)
+	}
+	return records
+}
+
+// restore replaces the records with the ones saved in the state file. The
+// statuses of the saved projects are taken as already observed so they are
+// not counted as runs again.
+func (d *flakyDetector) restore(records []flakyRecord, projects []Project) {
+	d.records = make(map[flakyKey]*flakyRecord)
+	for i := range records {
+		r := records[i]
+		d.records[flakyKey{r.Project, r.Job}] = &r
+	}
+
+	d.observeRuns(time.Now(), projects, false)
+}
@@ -0,0 +1,91 @@
+package cistatus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func flakyProjects(commit string, statuses ...Status) []Project {
+	return []Project{{Name: "api", Branches: []Branch{{Name: "master", Commit: commit, Statuses: statuses}}}}
+}
+
+func TestFlakyDetectorRepeatedRuns(t *testing.T) {
+	d := newFlakyDetector()
+	created := time.Now()
+	projects := flakyProjects("abc",
+		Status{Name: "test", Status: "failed", Created: created},
+		Status{Name: "test", Status: "success", Created: created.Add(time.Minute)},
+	)
+
+	// Fetchers reporting every run of a job report the same runs again on
+	// every poll, which must not count as new runs
+	for i := 0; i < 5; i++ {
+		d.observe(created.Add(2*time.Minute), projects)
+	}
+
+	job := d.records[flakyKey{"api", "test"}].job()
+	if job.Runs != 2 || job.Flips != 1 {
+		t.Errorf("%d runs and %d flips, want 2 runs and 1 flip", job.Runs, job.Flips)
+	}
+}
+
+func TestFlakyDetectorRetryAcrossFetches(t *testing.T) {
+	d := newFlakyDetector()
+	created := time.Now()
+
+	d.observe(created, flakyProjects("abc", Status{Name: "test", Status: "failed", Created: created}))
+
+	// The failed run is no longer reported once the job is retried
+	retry := flakyProjects("abc", Status{Name: "test", Status: "running", Created: created.Add(time.Minute)})
+	d.observe(created.Add(time.Minute), retry)
+	if status := d.annotate(retry)[0].Branches[0].Statuses[0]; !status.Retry {
+		t.Errorf("the retry of a failed run is not marked: %+v", status)
+	}
+
+	newCommit := flakyProjects("def", Status{Name: "test", Status: "running", Created: created.Add(time.Minute)})
+	if status := d.annotate(newCommit)[0].Branches[0].Statuses[0]; status.Retry {
+		t.Errorf("a run of another commit is marked as a retry: %+v", status)
+	}
+
+	d.observe(created.Add(2*time.Minute), flakyProjects("abc", Status{Name: "test", Status: "success", Created: created.Add(time.Minute)}))
+	job := d.records[flakyKey{"api", "test"}].job()
+	if job.Runs != 2 || job.Flips != 1 {
+		t.Errorf("%d runs and %d flips, want 2 runs and 1 flip", job.Runs, job.Flips)
+	}
+
+	if status := d.annotate(retry)[0].Branches[0].Statuses[0]; status.Retry {
+		t.Errorf("a run after a success is marked as a retry: %+v", status)
+	}
+}
+
+func TestFlakyDowngradeAcrossFetches(t *testing.T) {
+	created := time.Now()
+	fetcher := &staticFetcher{projects: flakyProjects("abc", Status{Name: "test", Status: "failed", Created: created})}
+
+	for _, downgrade := range []bool{false, true} {
+		s := NewServer(fetcher, time.Minute)
+		s.FlakyDowngrade = downgrade
+		go s.wsHub.run()
+
+		// The job flipped in half of its recent runs
+		s.flaky.records[flakyKey{"api", "test"}] = &flakyRecord{Project: "api", Job: "test", Outcomes: []bool{true, false}}
+
+		fetcher.projects = flakyProjects("abc", Status{Name: "test", Status: "failed", Created: created})
+		s.fetch(context.Background(), false)
+		if color := s.summary().Color; color != Red {
+			t.Errorf("downgrade %t: color %s of the failure, want %s", downgrade, color, Red)
+		}
+
+		fetcher.projects = flakyProjects("abc", Status{Name: "test", Status: "running", Created: created.Add(time.Minute)})
+		s.fetch(context.Background(), false)
+
+		want := Red
+		if downgrade {
+			want = Yellow
+		}
+		if color := s.summary().Color; color != want {
+			t.Errorf("downgrade %t: color %s of the retry, want %s", downgrade, color, want)
+		}
+	}
+}
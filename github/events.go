@@ -0,0 +1,246 @@
+package github
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"tantalic.com/cistatus"
+)
+
+// hookUpdate is the change to a branch described by a webhook event
+type hookUpdate struct {
+	project string
+	branch  cistatus.Branch
+	deleted bool
+}
+
+type repository struct {
+	Name string `json:"name"`
+}
+
+type user struct {
+	Login string `json:"login"`
+}
+
+type statusEvent struct {
+	Sha       string    `json:"sha"`
+	State     string    `json:"state"`
+	Context   string    `json:"context"`
+	CreatedAt time.Time `json:"created_at"`
+	Branches  []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			Sha string `json:"sha"`
+		} `json:"commit"`
+	} `json:"branches"`
+	Commit struct {
+		Author *user `json:"author"`
+	} `json:"commit"`
+	Repository repository `json:"repository"`
+	Sender     user       `json:"sender"`
+}
+
+type checkSuite struct {
+	HeadBranch string    `json:"head_branch"`
+	HeadSha    string    `json:"head_sha"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion"`
+	CreatedAt  time.Time `json:"created_at"`
+	App        struct {
+		Name string `json:"name"`
+	} `json:"app"`
+}
+
+type checkRunEvent struct {
+	CheckRun struct {
+		Name       string     `json:"name"`
+		HeadSha    string     `json:"head_sha"`
+		Status     string     `json:"status"`
+		Conclusion string     `json:"conclusion"`
+		StartedAt  time.Time  `json:"started_at"`
+		CheckSuite checkSuite `json:"check_suite"`
+	} `json:"check_run"`
+	Repository repository `json:"repository"`
+	Sender     user       `json:"sender"`
+}
+
+type checkSuiteEvent struct {
+	CheckSuite checkSuite `json:"check_suite"`
+	Repository repository `json:"repository"`
+	Sender     user       `json:"sender"`
+}
+
+type pushEvent struct {
+	Ref        string     `json:"ref"`
+	After      string     `json:"after"`
+	Deleted    bool       `json:"deleted"`
+	Repository repository `json:"repository"`
+	Sender     user       `json:"sender"`
+}
+
+// parseHook converts a webhook event into the branch updates it describes.
+// No updates are returned for events that do not affect the status of a
+// branch, such as tag pushes, pings or unsupported events.
+func parseHook(event string, payload []byte) ([]hookUpdate, error) {
+	switch event {
+	case "status":
+		var e statusEvent
+		err := json.Unmarshal(payload, &e)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse status event")
+		}
+
+		author := e.Sender.Login
+		if e.Commit.Author != nil {
+			author = e.Commit.Author.Login
+		}
+
+		// The event does not name a branch directly, every branch whose
+		// head is the commit is updated
+		var updates []hookUpdate
+		for _, b := range e.Branches {
+			if b.Commit.Sha != e.Sha {
+				continue
+			}
+
+			update, err := newUpdate(e.Repository, b.Name, e.Sha, cistatus.Status{
+				Name:    e.Context,
+				Status:  statusState(e.State),
+				Created: e.CreatedAt,
+				Author:  author,
+			})
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, update...)
+		}
+
+		return updates, nil
+
+	case "check_run":
+		var e checkRunEvent
+		err := json.Unmarshal(payload, &e)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse check_run event")
+		}
+
+		run := e.CheckRun
+		if run.CheckSuite.HeadBranch == "" {
+			return nil, nil
+		}
+
+		return newUpdate(e.Repository, run.CheckSuite.HeadBranch, run.HeadSha, cistatus.Status{
+			Name:    run.Name,
+			Status:  checkState(run.Status, run.Conclusion),
+			Created: run.StartedAt,
+			Author:  e.Sender.Login,
+		})
+
+	case "check_suite":
+		var e checkSuiteEvent
+		err := json.Unmarshal(payload, &e)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse check_suite event")
+		}
+
+		suite := e.CheckSuite
+		if suite.HeadBranch == "" {
+			return nil, nil
+		}
+
+		return newUpdate(e.Repository, suite.HeadBranch, suite.HeadSha, cistatus.Status{
+			Name:    suite.App.Name,
+			Status:  checkState(suite.Status, suite.Conclusion),
+			Created: suite.CreatedAt,
+			Author:  e.Sender.Login,
+		})
+
+	case "push":
+		var e pushEvent
+		err := json.Unmarshal(payload, &e)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse push event")
+		}
+
+		if !strings.HasPrefix(e.Ref, "refs/heads/") {
+			return nil, nil
+		}
+
+		if e.Repository.Name == "" {
+			return nil, errors.New("push event is missing the repository")
+		}
+
+		// A new commit replaces the branch and its statuses
+		return []hookUpdate{{
+			project: e.Repository.Name,
+			branch: cistatus.Branch{
+				Name:     strings.TrimPrefix(e.Ref, "refs/heads/"),
+				Commit:   e.After,
+				Statuses: []cistatus.Status{},
+			},
+			deleted: e.Deleted,
+		}}, nil
+	}
+
+	return nil, nil
+}
+
+// newUpdate returns the update setting a single status of a branch
+func newUpdate(repo repository, branch, commit string, status cistatus.Status) ([]hookUpdate, error) {
+	if repo.Name == "" || status.Name == "" {
+		return nil, errors.New("event is missing the repository or status name")
+	}
+
+	if status.Created.IsZero() {
+		status.Created = time.Now()
+	}
+
+	return []hookUpdate{{
+		project: repo.Name,
+		branch: cistatus.Branch{
+			Name:     branch,
+			Commit:   commit,
+			Statuses: []cistatus.Status{status},
+		},
+	}}, nil
+}
+
+// statusState maps a commit status state to the GitLab status names used
+// throughout cistatus
+func statusState(state string) string {
+	switch state {
+	case "success":
+		return "success"
+	case "failure", "error":
+		return "failed"
+	}
+
+	return "pending"
+}
+
+// checkState maps the status and conclusion of a check run or suite to the
+// GitLab status names used throughout cistatus
+func checkState(status, conclusion string) string {
+	switch status {
+	case "queued", "requested":
+		return "pending"
+	case "in_progress":
+		return "running"
+	}
+
+	switch conclusion {
+	case "success", "neutral":
+		return "success"
+	case "skipped":
+		return "skipped"
+	case "cancelled", "stale":
+		return "canceled"
+	case "failure", "timed_out", "action_required", "startup_failure":
+		return "failed"
+	}
+
+	return "pending"
+}
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"testing"
+)
+
+func TestParseStatusHookUpdatesEveryBranchAtTheCommit(t *testing.T) {
+	payload := []byte(`{
+		"sha": "abc",
+		"state": "failure",
+		"context": "ci/test",
+		"branches": [
+			{"name": "master", "commit": {"sha": "abc"}},
+			{"name": "release", "commit": {"sha": "abc"}},
+			{"name": "develop", "commit": {"sha": "def"}}
+		],
+		"commit": {"author": {"login": "alice"}},
+		"repository": {"name": "api"},
+		"sender": {"login": "bob"}
+	}`)
+
+	updates, err := parseHook("status", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(updates) != 2 {
+		t.Fatalf("got %d updates, want 2: %+v", len(updates), updates)
+	}
+
+	for i, name := range []string{"master", "release"} {
+		update := updates[i]
+		if update.project != "api" || update.branch.Name != name || update.branch.Commit != "abc" {
+			t.Errorf("update %d: unexpected %+v", i, update)
+		}
+		if len(update.branch.Statuses) != 1 || update.branch.Statuses[0].Status != "failed" || update.branch.Statuses[0].Author != "alice" {
+			t.Errorf("update %d: unexpected statuses %+v", i, update.branch.Statuses)
+		}
+	}
+}
+
+func TestParseStatusHookWithoutBranchAtTheCommit(t *testing.T) {
+	payload := []byte(`{
+		"sha": "abc",
+		"state": "success",
+		"context": "ci/test",
+		"branches": [{"name": "master", "commit": {"sha": "def"}}],
+		"repository": {"name": "api"}
+	}`)
+
+	updates, err := parseHook("status", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 0 {
+		t.Errorf("got %+v, want no updates", updates)
+	}
+}
+
+func TestParsePushHook(t *testing.T) {
+	updates, err := parseHook("push", []byte(`{"ref": "refs/tags/v1", "after": "abc", "repository": {"name": "api"}}`))
+	if err != nil || len(updates) != 0 {
+		t.Errorf("tag push: got %+v, %v", updates, err)
+	}
+
+	updates, err = parseHook("push", []byte(`{"ref": "refs/heads/master", "after": "abc", "repository": {"name": "api"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].branch.Name != "master" || updates[0].branch.Commit != "abc" || updates[0].deleted {
+		t.Errorf("branch push: got %+v", updates)
+	}
+}
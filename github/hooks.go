@@ -0,0 +1,130 @@
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"tantalic.com/cistatus"
+)
+
+const (
+	maxHookPayloadSize = 5 * 1024 * 1024
+
+	// maxRecentDeliveries is the number of delivery IDs remembered to
+	// detect redelivered events
+	maxRecentDeliveries = 1024
+
+	signaturePrefix = "sha256="
+)
+
+// HookHandler receives GitHub status, check_run, check_suite and push
+// webhook events and pushes them to a cistatus.Server.
+type HookHandler struct {
+	server *cistatus.Server
+	secret []byte
+
+	mu         sync.Mutex
+	deliveries map[string]bool
+	deliveryQ  []string
+}
+
+// NewHookHandler creates a handler for GitHub webhooks. Requests are only
+// accepted when the X-Hub-Signature-256 header is a valid HMAC of the
+// payload with secret; if secret is empty every request is rejected.
+func NewHookHandler(server *cistatus.Server, secret string) *HookHandler {
+	return &HookHandler{
+		server:     server,
+		secret:     []byte(secret),
+		deliveries: make(map[string]bool),
+	}
+}
+
+func (h *HookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxHookPayloadSize))
+	if err != nil {
+		http.Error(w, "unable to read payload", http.StatusBadRequest)
+		return
+	}
+
+	if !h.validSignature(r.Header.Get("X-Hub-Signature-256"), payload) {
+		h.server.Logger.Println("GitHub webhook rejected: invalid signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	updates, err := parseHook(event, payload)
+	if err != nil {
+		h.server.Logger.Printf("GitHub webhook error: %s\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if !h.firstDelivery(delivery) {
+		h.server.Logger.Printf("GitHub webhook delivery %s already processed\n", delivery)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	for _, update := range updates {
+		if update.deleted {
+			h.server.RemovePushedBranch(update.project, update.branch.Name)
+		} else {
+			h.server.PushBranch(update.project, update.branch)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validSignature reports whether signature is the HMAC-SHA256 of payload
+func (h *HookHandler) validSignature(signature string, payload []byte) bool {
+	if len(h.secret) == 0 || !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// firstDelivery records the delivery ID and reports whether it was seen for
+// the first time. Only the most recent deliveries are remembered.
+func (h *HookHandler) firstDelivery(id string) bool {
+	if id == "" {
+		return true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.deliveries[id] {
+		return false
+	}
+
+	h.deliveries[id] = true
+	h.deliveryQ = append(h.deliveryQ, id)
+	if len(h.deliveryQ) > maxRecentDeliveries {
+		delete(h.deliveries, h.deliveryQ[0])
+		h.deliveryQ = h.deliveryQ[1:]
+	}
+
+	return true
+}
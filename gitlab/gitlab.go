@@ -1,6 +1,8 @@
 package gitlab
 
 import (
+	"context"
+	"net/http"
 	"strconv"
 
 	"github.com/pkg/errors"
@@ -24,25 +26,30 @@ func NewClient(baseUrl, token string) *Client {
 	}
 }
 
-func (g Client) FetchStatus() ([]cistatus.Project, error) {
+// FetchStatus fetches the status of every branch of every project. Each
+// request to the GitLab API is cancelled once ctx is done.
+func (g Client) FetchStatus(ctx context.Context) ([]cistatus.Project, error) {
 	var results []cistatus.Project
 
-	projects, err := g.client.Projects()
+	client := g.withContext(ctx)
+
+	projects, err := client.Projects()
 	if err != nil {
-		return results, errors.Wrap(err, "unable to fetch projects")
+		return results, errors.Wrap(contextError(ctx, err), "unable to fetch projects")
 	}
 
 	for _, project := range projects {
 
 		p := cistatus.Project{
 			Name: project.Name,
+			URL:  project.WebUrl,
 		}
 
 		projectID := strconv.Itoa(project.Id)
 
-		branches, err := g.client.ProjectBranches(projectID)
+		branches, err := client.ProjectBranches(projectID)
 		if err != nil {
-			return results, errors.Wrapf(err, "unable to fetch branches for %s project", p)
+			return results, errors.Wrapf(contextError(ctx, err), "unable to fetch branches for %s project", p)
 		}
 
 		for _, branch := range branches {
@@ -52,9 +59,9 @@ func (g Client) FetchStatus() ([]cistatus.Project, error) {
 				Commit: branch.Commit.Id,
 			}
 
-			statuses, err := g.client.ProjectCommitStatuses(projectID, branch.Commit.Id)
+			statuses, err := client.ProjectCommitStatuses(projectID, branch.Commit.Id)
 			if err != nil {
-				return results, errors.Wrapf(err, "unable to fetch statuses for %s project, %s branch, %s commit", p, b, b.Commit)
+				return results, errors.Wrapf(contextError(ctx, err), "unable to fetch statuses for %s project, %s branch, %s commit", p, b, b.Commit)
 			}
 
 			b.Statuses = make([]cistatus.Status, 0)
@@ -76,3 +83,45 @@ func (g Client) FetchStatus() ([]cistatus.Project, error) {
 
 	return results, nil
 }
+
+// withContext returns a copy of the GitLab client whose requests are bound to
+// ctx. The vendored client does not accept a context so it is attached by
+// the transport.
+func (g Client) withContext(ctx context.Context) *gogitlab.Gitlab {
+	client := *g.client
+
+	transport := http.DefaultTransport
+	if g.client.Client != nil && g.client.Client.Transport != nil {
+		transport = g.client.Client.Transport
+	}
+
+	client.Client = &http.Client{
+		Transport: contextTransport{
+			ctx:       ctx,
+			transport: transport,
+		},
+	}
+
+	return &client
+}
+
+// contextError returns the context error if ctx is done, as the vendored
+// client does not preserve the underlying error.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// contextTransport is a http.RoundTripper that attaches a context to each
+// request before passing it to the underlying transport.
+type contextTransport struct {
+	ctx       context.Context
+	transport http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transport.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,213 @@
+package gitlab
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"tantalic.com/cistatus"
+)
+
+const (
+	maxHookPayloadSize = 1024 * 1024
+
+	// hookTimeLayout is the format GitLab uses for timestamps in webhook
+	// payloads. It is not RFC 3339, which is why the payloads are decoded
+	// here rather than with gogitlab.ParseHook.
+	hookTimeLayout = "2006-01-02 15:04:05 MST"
+)
+
+// HookHandler receives GitLab pipeline and job webhook events and applies
+// them to a cistatus.Server as they happen.
+type HookHandler struct {
+	server *cistatus.Server
+	secret string
+}
+
+// NewHookHandler creates a handler for GitLab webhooks. Requests are only
+// accepted when the X-Gitlab-Token header matches secret; if secret is empty
+// every request is rejected.
+func NewHookHandler(server *cistatus.Server, secret string) *HookHandler {
+	return &HookHandler{
+		server: server,
+		secret: secret,
+	}
+}
+
+func (h *HookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.Header.Get("X-Gitlab-Token")
+	if h.secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.secret)) != 1 {
+		h.server.Logger.Println("GitLab webhook rejected: invalid token")
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxHookPayloadSize))
+	if err != nil {
+		http.Error(w, "unable to read payload", http.StatusBadRequest)
+		return
+	}
+
+	project, branch, err := parseHook(payload)
+	if err != nil {
+		h.server.Logger.Printf("GitLab webhook error: %s\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if branch != nil {
+		h.server.UpdateBranch(project, *branch)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type hookUser struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+func (u hookUser) String() string {
+	if u.Username != "" {
+		return u.Username
+	}
+
+	return u.Name
+}
+
+type hookBuild struct {
+	Name      string   `json:"name"`
+	Status    string   `json:"status"`
+	CreatedAt string   `json:"created_at"`
+	User      hookUser `json:"user"`
+}
+
+// hookPayload is the subset of the GitLab pipeline ("pipeline") and job
+// ("build") webhook payloads needed to update a branch.
+type hookPayload struct {
+	ObjectKind string `json:"object_kind"`
+
+	Project struct {
+		Name string `json:"name"`
+	} `json:"project"`
+	Repository struct {
+		Name string `json:"name"`
+	} `json:"repository"`
+	User hookUser `json:"user"`
+
+	// Pipeline events
+	ObjectAttributes struct {
+		Ref string `json:"ref"`
+		Tag bool   `json:"tag"`
+		Sha string `json:"sha"`
+	} `json:"object_attributes"`
+	Builds []hookBuild `json:"builds"`
+
+	// Job events
+	Ref            string `json:"ref"`
+	Tag            bool   `json:"tag"`
+	Sha            string `json:"sha"`
+	BuildName      string `json:"build_name"`
+	BuildStatus    string `json:"build_status"`
+	BuildCreatedAt string `json:"build_created_at"`
+	BuildStarted   string `json:"build_started_at"`
+}
+
+// parseHook converts a webhook payload into the branch it updates. A nil
+// branch is returned for events that do not affect the status of a branch,
+// such as tag pipelines or unsupported event kinds.
+func parseHook(payload []byte) (string, *cistatus.Branch, error) {
+	var hook hookPayload
+	err := json.Unmarshal(payload, &hook)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "unable to parse webhook payload")
+	}
+
+	var project string
+	var branch cistatus.Branch
+
+	switch hook.ObjectKind {
+	case "pipeline":
+		if hook.ObjectAttributes.Tag {
+			return "", nil, nil
+		}
+
+		project = hook.Project.Name
+		branch = cistatus.Branch{
+			Name:     branchName(hook.ObjectAttributes.Ref),
+			Commit:   hook.ObjectAttributes.Sha,
+			Statuses: make([]cistatus.Status, 0, len(hook.Builds)),
+		}
+
+		for _, build := range hook.Builds {
+			branch.Statuses = append(branch.Statuses, cistatus.Status{
+				Name:    build.Name,
+				Status:  build.Status,
+				Created: hookTime(build.CreatedAt),
+				Author:  build.User.String(),
+			})
+		}
+
+	case "build":
+		if hook.Tag {
+			return "", nil, nil
+		}
+
+		created := hook.BuildCreatedAt
+		if created == "" {
+			created = hook.BuildStarted
+		}
+
+		project = hook.Repository.Name
+		branch = cistatus.Branch{
+			Name:   branchName(hook.Ref),
+			Commit: hook.Sha,
+			Statuses: []cistatus.Status{
+				{
+					Name:    hook.BuildName,
+					Status:  hook.BuildStatus,
+					Created: hookTime(created),
+					Author:  hook.User.String(),
+				},
+			},
+		}
+
+	default:
+		return "", nil, nil
+	}
+
+	if project == "" || branch.Name == "" {
+		return "", nil, errors.Errorf("%s webhook payload is missing the project or branch", hook.ObjectKind)
+	}
+
+	return project, &branch, nil
+}
+
+func branchName(ref string) string {
+	return strings.TrimPrefix(ref, "refs/heads/")
+}
+
+// hookTime parses a webhook timestamp, falling back to the current time
+// when it is missing or malformed.
+func hookTime(value string) time.Time {
+	t, err := time.Parse(hookTimeLayout, value)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return time.Now()
+	}
+
+	return t
+}
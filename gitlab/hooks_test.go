@@ -0,0 +1,130 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tantalic.com/cistatus"
+)
+
+func TestParsePipelineHook(t *testing.T) {
+	payload := `{
+		"object_kind": "pipeline",
+		"project": {"name": "api"},
+		"object_attributes": {"ref": "feature/login", "tag": false, "sha": "abc123"},
+		"builds": [
+			{"name": "test", "status": "failed", "created_at": "2017-04-11 20:00:00 UTC", "user": {"name": "Alice", "username": "alice"}},
+			{"name": "lint", "status": "success", "created_at": "2017-04-11T20:01:00Z", "user": {"name": "Bob"}}
+		]
+	}`
+
+	project, branch, err := parseHook([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &cistatus.Branch{
+		Name:   "feature/login",
+		Commit: "abc123",
+		Statuses: []cistatus.Status{
+			{Name: "test", Status: "failed", Created: time.Date(2017, 4, 11, 20, 0, 0, 0, time.UTC), Author: "alice"},
+			{Name: "lint", Status: "success", Created: time.Date(2017, 4, 11, 20, 1, 0, 0, time.UTC), Author: "Bob"},
+		},
+	}
+	if project != "api" {
+		t.Errorf("project %q, want api", project)
+	}
+	for i := range branch.Statuses {
+		branch.Statuses[i].Created = branch.Statuses[i].Created.UTC()
+	}
+	if !reflect.DeepEqual(branch, want) {
+		t.Errorf("unexpected branch\n got: %+v\nwant: %+v", branch, want)
+	}
+}
+
+func TestParseJobHook(t *testing.T) {
+	payload := `{
+		"object_kind": "build",
+		"repository": {"name": "api"},
+		"ref": "refs/heads/master",
+		"sha": "def456",
+		"build_name": "deploy",
+		"build_status": "running",
+		"build_started_at": "2017-04-11 21:00:00 UTC",
+		"user": {"name": "Alice"}
+	}`
+
+	project, branch, err := parseHook([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if project != "api" || branch.Name != "master" || branch.Commit != "def456" || len(branch.Statuses) != 1 {
+		t.Fatalf("unexpected %s project, branch %+v", project, branch)
+	}
+
+	status := branch.Statuses[0]
+	if status.Name != "deploy" || status.Status != "running" || status.Author != "Alice" || !status.Created.Equal(time.Date(2017, 4, 11, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestParseIgnoredHooks(t *testing.T) {
+	for _, payload := range []string{
+		`{"object_kind": "pipeline", "project": {"name": "api"}, "object_attributes": {"ref": "v1.0.0", "tag": true}}`,
+		`{"object_kind": "build", "repository": {"name": "api"}, "ref": "v1.0.0", "tag": true}`,
+		`{"object_kind": "push", "project": {"name": "api"}}`,
+	} {
+		_, branch, err := parseHook([]byte(payload))
+		if err != nil || branch != nil {
+			t.Errorf("%s: branch %+v, error %v", payload, branch, err)
+		}
+	}
+
+	for _, payload := range []string{
+		`{"object_kind": "pipeline", "object_attributes": {"ref": "master"}}`,
+		`{"object_kind": "build", "repository": {"name": "api"}}`,
+		`not json`,
+	} {
+		_, _, err := parseHook([]byte(payload))
+		if err == nil {
+			t.Errorf("%s: expected an error", payload)
+		}
+	}
+}
+
+type noFetcher struct{}
+
+func (noFetcher) FetchStatus(ctx context.Context) ([]cistatus.Project, error) {
+	return nil, nil
+}
+
+func TestHookHandlerToken(t *testing.T) {
+	server := cistatus.NewServer(noFetcher{}, time.Minute)
+
+	tests := []struct {
+		secret, token string
+		code          int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "wrong", http.StatusUnauthorized},
+		// A valid token reaches the payload, which is rejected
+		{"secret", "secret", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/hooks/gitlab", strings.NewReader("not json"))
+		r.Header.Set("X-Gitlab-Token", test.token)
+		w := httptest.NewRecorder()
+		NewHookHandler(server, test.secret).ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("secret %q, token %q: status %d, want %d", test.secret, test.token, w.Code, test.code)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package cistatus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultHistoryRetention is how long transitions are kept by default
+	DefaultHistoryRetention = 90 * 24 * time.Hour
+
+	// DefaultHistoryMaxBytes limits the total size of the segments by
+	// default
+	DefaultHistoryMaxBytes = 256 * 1024 * 1024
+
+	// historySegmentDuration and historySegmentSize limit each segment,
+	// whichever is reached first starts a new segment
+	historySegmentDuration = 24 * time.Hour
+	historySegmentSize     = 8 * 1024 * 1024
+
+	// historyQueueSize is the number of recorded batches of transitions
+	// waiting to be written beyond which recording waits for the disk
+	historyQueueSize = 256
+
+	historySegmentPrefix = "history-"
+	historySegmentSuffix = ".jsonl"
+	historySegmentLayout = "20060102T150405.000000000Z"
+)
+
+const (
+	// JobTransition is the kind of transition recorded when the state or
+	// commit of a job changes
+	JobTransition = "job"
+	// ColorTransition is the kind of transition recorded when the overall
+	// color changes
+	ColorTransition = "color"
+)
+
+// Transition is a change of the state of a job or of the overall color
+type Transition struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Project string    `json:"project,omitempty"`
+	Branch  string    `json:"branch,omitempty"`
+	Job     string    `json:"job,omitempty"`
+	Commit  string    `json:"commit,omitempty"`
+	Author  string    `json:"author,omitempty"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to"`
+}
+
+// jobKey identifies a job in the last recorded states
+type jobKey struct {
+	project, branch, job string
+}
+
+type jobState struct {
+	state, commit string
+}
+
+// HistoryStore is an append-only store of transitions kept in JSON-lines
+// segment files in a directory. Segments older than Retention are removed
+// and the oldest segments are removed while the total size exceeds
+// MaxBytes.
+type HistoryStore struct {
+	Dir       string
+	Retention time.Duration
+	MaxBytes  int64
+
+	mu        sync.Mutex
+	lastID    int64
+	lastJobs  map[jobKey]jobState
+	lastColor Color
+	queue     chan []Transition
+	written   chan struct{}
+
+	// writeErr is the last error writing queued transitions. It has its
+	// own lock as record holds mu while waiting for the queue.
+	writeMu  sync.Mutex
+	writeErr error
+
+	// The segment is only used by the writer goroutine
+	segment      *os.File
+	segmentStart time.Time
+	segmentSize  int64
+	closed       bool
+
+	statsMu         sync.Mutex
+	statsCheckpoint *statsCheckpoint
+}
+
+// historySegment is a segment file and the time of its first transition
+type historySegment struct {
+	path  string
+	start time.Time
+	size  int64
+}
+
+// OpenHistory opens, creating if needed, the history store in dir. The
+// existing segments are read to find the last recorded state of every job
+// so restarts do not record spurious transitions. Transitions are written
+// by a goroutine running until Close.
+func OpenHistory(dir string) (*HistoryStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create history directory")
+	}
+
+	h := &HistoryStore{
+		Dir:       dir,
+		Retention: DefaultHistoryRetention,
+		MaxBytes:  DefaultHistoryMaxBytes,
+		lastJobs:  make(map[jobKey]jobState),
+		queue:     make(chan []Transition, historyQueueSize),
+		written:   make(chan struct{}),
+	}
+
+	segments, err := h.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, segment := range segments {
+		err := readSegment(segment.path, func(t Transition) bool {
+			h.apply(t)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	go h.writeQueued()
+	return h, nil
+}
+
+// apply updates the last recorded states with the transition
+func (h *HistoryStore) apply(t Transition) {
+	if t.ID > h.lastID {
+		h.lastID = t.ID
+	}
+
+	switch t.Kind {
+	case JobTransition:
+		h.lastJobs[jobKey{t.Project, t.Branch, t.Job}] = jobState{t.To, t.Commit}
+	case ColorTransition:
+		h.lastColor = Color(t.To)
+	}
+}
+
+// Close writes the transitions still queued and closes the current
+// segment. Transitions recorded after Close are discarded.
+func (h *HistoryStore) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+
+	<-h.written
+
+	err := h.writeError()
+	if h.segment != nil {
+		closeErr := h.segment.Close()
+		h.segment = nil
+		if err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// record queues a transition for every job whose state or commit differs
+// from the last recorded one, and for the overall color if it changed. It
+// is called with the server's mu held so the transitions are written to
+// disk by another goroutine; an error writing earlier transitions is
+// returned instead. Recording only waits for the disk when too many
+// transitions are queued.
+func (h *HistoryStore) record(now time.Time, projects []Project, overall Color) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	err := h.writeError()
+
+	var transitions []Transition
+	for _, project := range projects {
+		for _, branch := range project.Branches {
+			for _, status := range branch.Statuses {
+				key := jobKey{project.Name, branch.Name, status.Name}
+				last, seen := h.lastJobs[key]
+				if seen && last.state == status.Status && last.commit == branch.Commit {
+					continue
+				}
+
+				transitions = append(transitions, Transition{
+					Time:    now,
+					Kind:    JobTransition,
+					Project: project.Name,
+					Branch:  branch.Name,
+					Job:     status.Name,
+					Commit:  branch.Commit,
+					Author:  status.Author,
+					From:    last.state,
+					To:      status.Status,
+				})
+			}
+		}
+	}
+
+	if overall != Unknown && overall != h.lastColor {
+		transitions = append(transitions, Transition{
+			Time: now,
+			Kind: ColorTransition,
+			From: string(h.lastColor),
+			To:   string(overall),
+		})
+	}
+
+	if len(transitions) == 0 {
+		return err
+	}
+
+	for i := range transitions {
+		transitions[i].ID = h.lastID + 1
+		h.apply(transitions[i])
+	}
+	h.queue <- transitions
+
+	return err
+}
+
+// writeQueued writes the queued transitions until the queue is closed
+func (h *HistoryStore) writeQueued() {
+	defer close(h.written)
+
+	for transitions := range h.queue {
+		err := h.write(transitions)
+		if err != nil {
+			h.writeMu.Lock()
+			h.writeErr = err
+			h.writeMu.Unlock()
+		}
+	}
+}
+
+// writeError returns and clears the last error writing queued transitions
+func (h *HistoryStore) writeError() error {
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	err := h.writeErr
+	h.writeErr = nil
+	return err
+}
+
+// write appends transitions recorded at the same time to the current
+// segment
+func (h *HistoryStore) write(transitions []Transition) error {
+	var b bytes.Buffer
+	for _, t := range transitions {
+		data, err := json.Marshal(t)
+		if err != nil {
+			return errors.Wrap(err, "unable to encode transition")
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+
+	err := h.rotate(transitions[0].Time)
+	if err != nil {
+		return err
+	}
+
+	n, err := h.segment.Write(b.Bytes())
+	h.segmentSize += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "unable to write history")
+	}
+
+	return nil
+}
+
+// rotate starts a new segment if there is none or the current one is full,
+// removing expired segments when it does. It is only called by the writer
+// goroutine.
+func (h *HistoryStore) rotate(now time.Time) error {
+	if h.segment != nil && now.Sub(h.segmentStart) < historySegmentDuration && h.segmentSize < historySegmentSize {
+		return nil
+	}
+
+	if h.segment != nil {
+		h.segment.Close()
+		h.segment = nil
+	}
+
+	start := now.UTC()
+	name := historySegmentPrefix + start.Format(historySegmentLayout) + historySegmentSuffix
+	segment, err := os.OpenFile(filepath.Join(h.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to create history segment")
+	}
+
+	h.segment = segment
+	h.segmentStart = start
+	h.segmentSize = 0
+
+	return h.prune(now)
+}
+
+// prune removes the segments that only hold transitions older than the
+// retention and the oldest segments while the total size is over MaxBytes.
+// The current segment is never removed.
+func (h *HistoryStore) prune(now time.Time) error {
+	segments, err := h.segments()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, segment := range segments {
+		total += segment.size
+	}
+
+	for i, segment := range segments[:len(segments)-1] {
+		// A segment ends where the next one starts
+		expired := h.Retention > 0 && now.Sub(segments[i+1].start) > h.Retention
+		oversized := h.MaxBytes > 0 && total > h.MaxBytes
+		if !expired && !oversized {
+			break
+		}
+
+		err := os.Remove(segment.path)
+		if err != nil {
+			return errors.Wrap(err, "unable to remove history segment")
+		}
+		total -= segment.size
+	}
+
+	return nil
+}
+
+// segments returns the segment files ordered from oldest to newest
+func (h *HistoryStore) segments() ([]historySegment, error) {
+	files, err := ioutil.ReadDir(h.Dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read history directory")
+	}
+
+	var segments []historySegment
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, historySegmentPrefix) || !strings.HasSuffix(name, historySegmentSuffix) {
+			continue
+		}
+
+		start, err := time.Parse(historySegmentLayout, strings.TrimSuffix(strings.TrimPrefix(name, historySegmentPrefix), historySegmentSuffix))
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, historySegment{
+			path:  filepath.Join(h.Dir, name),
+			start: start,
+			size:  file.Size(),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].start.Before(segments[j].start)
+	})
+
+	return segments, nil
+}
+
+// readSegment calls fn with each transition in the segment, oldest first,
+// until fn returns false. Lines that cannot be decoded, such as one
+// partially written before a crash, are skipped.
+func readSegment(path string, fn func(Transition) bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// Removed by prune since it was listed
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to read history segment")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var t Transition
+		if json.Unmarshal(scanner.Bytes(), &t) != nil {
+			continue
+		}
+
+		if !fn(t) {
+			return nil
+		}
+	}
+
+	return errors.Wrap(scanner.Err(), "unable to read history segment")
+}
+
+// Each calls fn with every recorded transition, oldest first, until fn
+// returns false
+func (h *HistoryStore) Each(fn func(Transition) bool) error {
+	return h.eachFrom(time.Time{}, fn)
+}
+
+// eachFrom is Each skipping the segments that only hold transitions before
+// from. Transitions before from in the first segment read are not skipped.
+func (h *HistoryStore) eachFrom(from time.Time, fn func(Transition) bool) error {
+	segments, err := h.segments()
+	if err != nil {
+		return err
+	}
+
+	for len(segments) > 1 && !segments[1].start.After(from) {
+		segments = segments[1:]
+	}
+
+	more := true
+	for _, segment := range segments {
+		err := readSegment(segment.path, func(t Transition) bool {
+			more = fn(t)
+			return more
+		})
+		if err != nil || !more {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HistoryQuery selects transitions. Empty fields match everything.
+type HistoryQuery struct {
+	Since, Until time.Time
+	Kind         string
+	Projects     map[string]bool
+	Branches     map[string]bool
+	Jobs         map[string]bool
+	States       map[string]bool
+
+	// Before only matches transitions with a lower ID, for pagination
+	Before int64
+}
+
+func (q HistoryQuery) matches(t Transition) bool {
+	switch {
+	case !q.Since.IsZero() && t.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !t.Time.Before(q.Until):
+		return false
+	case q.Kind != "" && t.Kind != q.Kind:
+		return false
+	case q.Before > 0 && t.ID >= q.Before:
+		return false
+	case q.Projects != nil && !q.Projects[t.Project]:
+		return false
+	case q.Branches != nil && !q.Branches[t.Branch]:
+		return false
+	case q.Jobs != nil && !q.Jobs[t.Job]:
+		return false
+	case q.States != nil && !q.States[t.To]:
+		return false
+	}
+
+	return true
+}
+
+// Query returns up to limit transitions matching q, newest first, and
+// whether there are more.
+func (h *HistoryStore) Query(q HistoryQuery, limit int) ([]Transition, bool, error) {
+	segments, err := h.segments()
+	if err != nil {
+		return nil, false, err
+	}
+
+	results := []Transition{}
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if !q.Until.IsZero() && !segment.start.Before(q.Until) {
+			continue
+		}
+		if !q.Since.IsZero() && i+1 < len(segments) && segments[i+1].start.Before(q.Since) {
+			break
+		}
+
+		var matched []Transition
+		err := readSegment(segment.path, func(t Transition) bool {
+			if q.matches(t) {
+				matched = append(matched, t)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, false, err
+		}
+
+		for j := len(matched) - 1; j >= 0; j-- {
+			if limit > 0 && len(results) == limit {
+				return results, true, nil
+			}
+			results = append(results, matched[j])
+		}
+	}
+
+	return results, false, nil
+}
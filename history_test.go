@@ -0,0 +1,58 @@
+package cistatus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryWritesQueuedTransitionsOnClose(t *testing.T) {
+	h, cleanup := openTestHistory(t)
+	defer cleanup()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < historyQueueSize*2; i++ {
+		state := "success"
+		if i%2 == 0 {
+			state = "failed"
+		}
+		recordBranch(t, h, start.Add(time.Duration(i)*time.Second), "abc", Status{Name: "test", Status: state})
+	}
+
+	err := h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recording after Close is discarded
+	recordBranch(t, h, start.Add(time.Hour), "def", Status{Name: "test", Status: "running"})
+
+	reopened, err := OpenHistory(h.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	var ids []int64
+	err = reopened.Each(func(t Transition) bool {
+		if t.Kind == JobTransition {
+			ids = append(ids, t.ID)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != historyQueueSize*2 {
+		t.Fatalf("expected %d job transitions, got %d", historyQueueSize*2, len(ids))
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("transitions out of order: %d after %d", ids[i], ids[i-1])
+		}
+	}
+
+	if reopened.lastJobs[jobKey{"api", "master", "test"}].state != "success" {
+		t.Errorf("unexpected last state %+v", reopened.lastJobs)
+	}
+}
@@ -0,0 +1,204 @@
+package cistatus
+
+// mergeBranch returns a copy of projects with branch merged into the named
+// project, adding the project and branch if they do not exist. The slices
+// in projects are never modified as they may be shared with readers of an
+// earlier summary.
+func mergeBranch(projects []Project, projectName string, branch Branch) []Project {
+	merged := make([]Project, len(projects))
+	copy(merged, projects)
+
+	for i := range merged {
+		if merged[i].Name != projectName {
+			continue
+		}
+
+		merged[i].Branches = mergeBranches(merged[i].Branches, branch)
+		return merged
+	}
+
+	return append(merged, Project{
+		Name:     projectName,
+		Branches: []Branch{branch},
+	})
+}
+
+// mergeBranches returns a copy of branches with branch merged in. When both
+// are at the same commit, or either has no commit, the statuses are merged
+// by name and the branch is at the commit of whichever has one. Otherwise
+// the branch is replaced.
+func mergeBranches(branches []Branch, branch Branch) []Branch {
+	merged := make([]Branch, len(branches))
+	copy(merged, branches)
+
+	for i := range merged {
+		if merged[i].Name != branch.Name {
+			continue
+		}
+
+		switch {
+		case merged[i].Commit == branch.Commit || branch.Commit == "":
+			merged[i].Statuses = mergeStatuses(merged[i].Statuses, branch.Statuses)
+		case merged[i].Commit == "":
+			merged[i].Statuses = mergeStatuses(merged[i].Statuses, branch.Statuses)
+			merged[i].Commit = branch.Commit
+		default:
+			merged[i] = branch
+		}
+		return merged
+	}
+
+	return append(merged, branch)
+}
+
+// mergeStatuses returns a copy of statuses with updates replacing the
+// statuses of the same name and any new statuses appended.
+func mergeStatuses(statuses []Status, updates []Status) []Status {
+	merged := make([]Status, len(statuses))
+	copy(merged, statuses)
+
+	for _, update := range updates {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == update.Name {
+				merged[i] = update
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			merged = append(merged, update)
+		}
+	}
+
+	return merged
+}
+
+// removeBranch returns a copy of projects without the named branch. Projects
+// left without any branches are removed.
+func removeBranch(projects []Project, projectName, branchName string) []Project {
+	removed := make([]Project, 0, len(projects))
+
+	for _, project := range projects {
+		if project.Name != projectName {
+			removed = append(removed, project)
+			continue
+		}
+
+		branches := make([]Branch, 0, len(project.Branches))
+		for _, branch := range project.Branches {
+			if branch.Name != branchName {
+				branches = append(branches, branch)
+			}
+		}
+
+		if len(branches) > 0 {
+			project.Branches = branches
+			removed = append(removed, project)
+		}
+	}
+
+	return removed
+}
+
+// dropStaleBranches returns a copy of pushed without the branches pushed for
+// a commit that the fetched branch has moved on from, that is whose fetched
+// commit changed from previous to one other than the pushed commit. Branches
+// pushed without a commit are kept as they follow the fetched branch.
+func dropStaleBranches(pushed, previous, fetched []Project) []Project {
+	kept := make([]Project, 0, len(pushed))
+
+	for _, project := range pushed {
+		branches := make([]Branch, 0, len(project.Branches))
+		for _, branch := range project.Branches {
+			commit, ok := branchCommit(fetched, project.Name, branch.Name)
+			before, _ := branchCommit(previous, project.Name, branch.Name)
+			if branch.Commit == "" || !ok || commit == before || commit == branch.Commit {
+				branches = append(branches, branch)
+			}
+		}
+
+		if len(branches) > 0 {
+			project.Branches = branches
+			kept = append(kept, project)
+		}
+	}
+
+	return kept
+}
+
+// branchCommit returns the commit of the named branch and whether it exists
+func branchCommit(projects []Project, projectName, branchName string) (string, bool) {
+	for _, project := range projects {
+		if project.Name != projectName {
+			continue
+		}
+
+		for _, branch := range project.Branches {
+			if branch.Name == branchName {
+				return branch.Commit, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// findStatus returns the named status and the commit of the branch it
+// belongs to
+func findStatus(projects []Project, projectName, branchName, statusName string) (Status, string, bool) {
+	for _, project := range projects {
+		if project.Name != projectName {
+			continue
+		}
+
+		for _, branch := range project.Branches {
+			if branch.Name != branchName {
+				continue
+			}
+
+			for _, status := range branch.Statuses {
+				if status.Name == statusName {
+					return status, branch.Commit, true
+				}
+			}
+		}
+	}
+
+	return Status{}, "", false
+}
+
+// AddStatus appends status to the named project and branch, adding the
+// project and branch if they do not exist. It is intended for Fetchers that
+// build their results one status at a time; the commit of an existing branch
+// is kept unless it is empty.
+func AddStatus(projects []Project, projectName string, branch Branch, status Status) []Project {
+	p := -1
+	for i := range projects {
+		if projects[i].Name == projectName {
+			p = i
+			break
+		}
+	}
+	if p < 0 {
+		projects = append(projects, Project{Name: projectName})
+		p = len(projects) - 1
+	}
+
+	for i := range projects[p].Branches {
+		if projects[p].Branches[i].Name == branch.Name {
+			b := &projects[p].Branches[i]
+			b.Statuses = append(b.Statuses, status)
+			if b.Commit == "" {
+				b.Commit = branch.Commit
+			}
+			return projects
+		}
+	}
+
+	branch.Statuses = []Status{status}
+	projects[p].Branches = append(projects[p].Branches, branch)
+
+	return projects
+}
@@ -0,0 +1,209 @@
+package cistatus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeBranch(t *testing.T) {
+	projects := []Project{{
+		Name: "api",
+		Branches: []Branch{{
+			Name:     "master",
+			Commit:   "abc",
+			Statuses: []Status{{Name: "build", Status: "success"}, {Name: "test", Status: "failed"}},
+		}},
+	}}
+
+	tests := []struct {
+		name   string
+		branch Branch
+		want   Branch
+	}{
+		{
+			name:   "same commit merges the statuses",
+			branch: Branch{Name: "master", Commit: "abc", Statuses: []Status{{Name: "test", Status: "success"}, {Name: "deploy", Status: "running"}}},
+			want:   Branch{Name: "master", Commit: "abc", Statuses: []Status{{Name: "build", Status: "success"}, {Name: "test", Status: "success"}, {Name: "deploy", Status: "running"}}},
+		},
+		{
+			name:   "no commit merges the statuses and keeps the commit",
+			branch: Branch{Name: "master", Statuses: []Status{{Name: "deploy", Status: "failed"}}},
+			want:   Branch{Name: "master", Commit: "abc", Statuses: []Status{{Name: "build", Status: "success"}, {Name: "test", Status: "failed"}, {Name: "deploy", Status: "failed"}}},
+		},
+		{
+			name:   "another commit replaces the branch",
+			branch: Branch{Name: "master", Commit: "def", Statuses: []Status{{Name: "build", Status: "pending"}}},
+			want:   Branch{Name: "master", Commit: "def", Statuses: []Status{{Name: "build", Status: "pending"}}},
+		},
+	}
+
+	for _, test := range tests {
+		merged := mergeBranch(projects, "api", test.branch)
+		if len(merged) != 1 || len(merged[0].Branches) != 1 {
+			t.Errorf("%s: unexpected projects %+v", test.name, merged)
+			continue
+		}
+		if got := merged[0].Branches[0]; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	if got := projects[0].Branches[0].Statuses; len(got) != 2 || got[1].Status != "failed" {
+		t.Errorf("merging modified the original projects: %+v", got)
+	}
+
+	commitless := []Branch{{Name: "master", Statuses: []Status{{Name: "security", Status: "success"}}}}
+	got := mergeBranches(commitless, Branch{Name: "master", Commit: "abc", Statuses: []Status{{Name: "deploy", Status: "failed"}}})
+	want := []Branch{{Name: "master", Commit: "abc", Statuses: []Status{{Name: "security", Status: "success"}, {Name: "deploy", Status: "failed"}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("a commit joining a branch without one: got %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeBranchAdds(t *testing.T) {
+	projects := []Project{{Name: "api", Branches: []Branch{{Name: "master"}}}}
+
+	merged := mergeBranch(projects, "api", Branch{Name: "develop"})
+	merged = mergeBranch(merged, "web", Branch{Name: "master"})
+
+	want := []Project{
+		{Name: "api", Branches: []Branch{{Name: "master"}, {Name: "develop"}}},
+		{Name: "web", Branches: []Branch{{Name: "master"}}},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("got %+v, want %+v", merged, want)
+	}
+}
+
+func TestPushStatusWithoutCommit(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	go s.wsHub.run()
+
+	s.mu.Lock()
+	s.fetchedProjects = []Project{{
+		Name:     "api",
+		Branches: []Branch{{Name: "master", Commit: "abc", Statuses: []Status{{Name: "build", Status: "success"}}}},
+	}}
+	s.mu.Unlock()
+
+	s.pushStatus("api", "master", "", Status{Name: "deploy", Status: "failed"})
+
+	summary := s.summary()
+	if len(summary.Projects) != 1 || len(summary.Projects[0].Branches) != 1 {
+		t.Fatalf("unexpected projects %+v", summary.Projects)
+	}
+	branch := summary.Projects[0].Branches[0]
+	if branch.Commit != "abc" || len(branch.Statuses) != 2 {
+		t.Errorf("the pushed status did not join the fetched branch: %+v", branch)
+	}
+	if summary.Color != Red {
+		t.Errorf("color %s, want %s", summary.Color, Red)
+	}
+}
+
+func TestExpireStatus(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	go s.wsHub.run()
+
+	created := time.Now().Add(-time.Hour)
+	expires := created.Add(time.Minute)
+	s.pushStatus("api", "master", "abc", Status{Name: "deploy", Status: "success", Created: created, Expires: &expires})
+	if color := s.summary().Color; color != Green {
+		t.Fatalf("color %s before the expiry, want %s", color, Green)
+	}
+
+	s.expireStatus("api", "master", "deploy")
+
+	status, _, ok := findStatus(s.summary().Projects, "api", "master", "deploy")
+	if !ok || status.Status != UnknownStatus || status.Expires != nil {
+		t.Errorf("unexpected expired status %+v", status)
+	}
+	if color := s.summary().Color; color != Unknown {
+		t.Errorf("color %s after the expiry, want %s", color, Unknown)
+	}
+}
+
+func TestDropStaleBranches(t *testing.T) {
+	previous := []Project{{Name: "api", Branches: []Branch{{Name: "master", Commit: "abc"}, {Name: "develop", Commit: "abc"}}}}
+	fetched := []Project{{Name: "api", Branches: []Branch{{Name: "master", Commit: "def"}, {Name: "develop", Commit: "abc"}}}}
+	pushed := []Project{
+		{Name: "api", Branches: []Branch{
+			{Name: "master", Commit: "abc"},
+			{Name: "develop", Commit: "fed"},
+		}},
+		{Name: "web", Branches: []Branch{{Name: "master", Commit: "abc"}}},
+		{Name: "docs", Branches: []Branch{{Name: "master"}}},
+	}
+
+	got := dropStaleBranches(pushed, previous, fetched)
+	want := []Project{
+		// develop was pushed ahead of the fetched branch, which has not moved
+		{Name: "api", Branches: []Branch{{Name: "develop", Commit: "fed"}}},
+		{Name: "web", Branches: []Branch{{Name: "master", Commit: "abc"}}},
+		{Name: "docs", Branches: []Branch{{Name: "master"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Once fetched at the pushed commit the pushed branch is merged
+	caughtUp := []Project{{Name: "api", Branches: []Branch{{Name: "develop", Commit: "fed"}}}}
+	if got := dropStaleBranches(want, fetched, caughtUp); len(got) != 3 {
+		t.Errorf("dropped a pushed branch the fetched branch caught up with: %+v", got)
+	}
+}
+
+func TestPushedStatusesAfterFetchedCommitMoves(t *testing.T) {
+	fetched := func(commit, status string) []Project {
+		statuses := []Status{{Name: "build", Status: status}}
+		return []Project{{
+			Name: "api",
+			Branches: []Branch{
+				{Name: "master", Commit: commit, Statuses: statuses},
+				{Name: "develop", Commit: commit, Statuses: statuses},
+			},
+		}}
+	}
+
+	fetcher := &staticFetcher{projects: fetched("abc", "success")}
+	s := NewServer(fetcher, time.Minute)
+	go s.wsHub.run()
+
+	s.fetch(context.Background(), false)
+	s.pushStatus("api", "master", "abc", Status{Name: "deploy", Status: "failed"})
+	s.pushStatus("api", "develop", "", Status{Name: "security", Status: "success"})
+
+	fetcher.projects = fetched("def", "running")
+	s.fetch(context.Background(), false)
+
+	summary := s.summary()
+	if len(summary.Projects) != 1 || len(summary.Projects[0].Branches) != 2 {
+		t.Fatalf("unexpected projects %+v", summary.Projects)
+	}
+
+	want := map[string][]string{
+		// The status pushed for the old commit no longer hides the fetched ones
+		"master": {"build=running"},
+		// The status pushed without a commit follows the fetched branch
+		"develop": {"build=running", "security=success"},
+	}
+	for _, branch := range summary.Projects[0].Branches {
+		if branch.Commit != "def" {
+			t.Errorf("%s: commit %s, want the fetched commit def", branch.Name, branch.Commit)
+		}
+
+		var statuses []string
+		for _, status := range branch.Statuses {
+			statuses = append(statuses, status.Name+"="+status.Status)
+		}
+		if !reflect.DeepEqual(statuses, want[branch.Name]) {
+			t.Errorf("%s: statuses %v, want %v", branch.Name, statuses, want[branch.Name])
+		}
+	}
+
+	if summary.Color != Yellow {
+		t.Errorf("color %s, want %s", summary.Color, Yellow)
+	}
+}
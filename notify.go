@@ -0,0 +1,388 @@
+package cistatus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+const (
+	// BrokenEvent is sent when a branch turns red
+	BrokenEvent = "broken"
+	// FixedEvent is sent when a broken branch turns green again
+	FixedEvent = "fixed"
+	// StillFailingEvent is sent every StillFailingAfter while a branch
+	// stays red
+	StillFailingEvent = "still-failing"
+
+	// DefaultMaxRetryTime is how long the delivery of a notification is
+	// retried by default
+	DefaultMaxRetryTime = 5 * time.Minute
+
+	// notifyAttemptTimeout limits each delivery attempt
+	notifyAttemptTimeout = 30 * time.Second
+
+	// notifyQueueSize is the number of notifications waiting for delivery
+	// to a subscription beyond which new ones are dropped
+	notifyQueueSize = 64
+)
+
+// Notification describes a transition of a branch worth telling people
+// about
+type Notification struct {
+	Event   string    `json:"event"`
+	Project string    `json:"project"`
+	Branch  string    `json:"branch"`
+	Commit  string    `json:"commit,omitempty"`
+	URL     string    `json:"url,omitempty"`
+	Failed  []string  `json:"failed,omitempty"`
+	Authors []string  `json:"authors,omitempty"`
+	Since   time.Time `json:"since"`
+	Time    time.Time `json:"time"`
+
+	// BrokenBy and BrokenCommit are the author and commit of the first
+	// failing status since the branch was last green
+	BrokenBy     string `json:"brokenBy,omitempty"`
+	BrokenCommit string `json:"brokenCommit,omitempty"`
+}
+
+// String describes the notification in a short sentence
+func (n Notification) String() string {
+	name := n.Project + "/" + n.Branch
+	broken := n.Time.Sub(n.Since) / time.Second * time.Second
+
+	switch n.Event {
+	case BrokenEvent:
+		return fmt.Sprintf("%s is broken: %s failed", name, strings.Join(n.Failed, ", "))
+	case FixedEvent:
+		return fmt.Sprintf("%s is fixed after %s", name, broken)
+	case StillFailingEvent:
+		return fmt.Sprintf("%s is still failing after %s: %s failed", name, broken, strings.Join(n.Failed, ", "))
+	}
+
+	return fmt.Sprintf("%s: %s", name, n.Event)
+}
+
+// Notifier delivers notifications, such as to a chat or by email.
+// Implementations should abandon the delivery and return once ctx is done.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Subscription sends the notifications matching its filters to a Notifier.
+// The Projects, Branches and Events filters match everything when nil. At
+// most RateLimit notifications are sent every RatePeriod, the others are
+// dropped. A failed delivery is retried with an exponential backoff for up
+// to MaxRetryTime, DefaultMaxRetryTime when zero. In DryRun mode
+// notifications are logged instead of sent.
+type Subscription struct {
+	Name     string
+	Notifier Notifier
+
+	Projects map[string]bool
+	Branches map[string]bool
+	Events   map[string]bool
+
+	RateLimit  int
+	RatePeriod time.Duration
+
+	MaxRetryTime time.Duration
+	DryRun       bool
+
+	queue chan Notification
+	sent  []time.Time
+}
+
+func (sub *Subscription) matches(n Notification) bool {
+	switch {
+	case sub.Projects != nil && !sub.Projects[n.Project]:
+		return false
+	case sub.Branches != nil && !sub.Branches[n.Branch]:
+		return false
+	case sub.Events != nil && !sub.Events[n.Event]:
+		return false
+	}
+	return true
+}
+
+// allow reports whether the rate limit allows a notification at now and
+// records it if so
+func (sub *Subscription) allow(now time.Time) bool {
+	if sub.RateLimit <= 0 || sub.RatePeriod <= 0 {
+		return true
+	}
+
+	recent := sub.sent[:0]
+	for _, sent := range sub.sent {
+		if now.Sub(sent) < sub.RatePeriod {
+			recent = append(recent, sent)
+		}
+	}
+	sub.sent = recent
+
+	if len(sub.sent) >= sub.RateLimit {
+		return false
+	}
+	sub.sent = append(sub.sent, now)
+	return true
+}
+
+// branchHealth is what the server remembers of a branch to detect
+// transitions worth a notification
+type branchHealth struct {
+	broken   bool
+	since    time.Time
+	reminded time.Time
+
+	brokenBy     string
+	brokenCommit string
+}
+
+// breaks marks the branch as broken by its first failing status
+func (h *branchHealth) breaks(branch Branch, now time.Time) {
+	h.broken = true
+	h.since, h.reminded = now, now
+	h.brokenBy, h.brokenCommit = "", branch.Commit
+
+	var first *Status
+	for i, status := range branch.Statuses {
+		if !status.failing() {
+			continue
+		}
+		if first == nil || !status.Created.IsZero() && (first.Created.IsZero() || status.Created.Before(first.Created)) {
+			first = &branch.Statuses[i]
+		}
+	}
+	if first == nil {
+		return
+	}
+
+	h.brokenBy = first.Author
+	if !first.Created.IsZero() && first.Created.Before(now) {
+		h.since = first.Created
+	}
+}
+
+// detectTransitions compares the color of every branch to the previous one
+// and returns the notifications to send. Branches seen before the first
+// successful fetch or restored state are not reported, so starting the
+// server does not notify every broken branch again. s.mu must be held.
+func (s *Server) detectTransitions(now time.Time, projects []Project) []Notification {
+	var notifications []Notification
+	seen := make(map[branchKey]bool)
+
+	for _, project := range projects {
+		for _, branch := range project.Branches {
+			key := branchKey{project.Name, branch.Name}
+			seen[key] = true
+
+			c := branchColor(branch, s.colorPolicy())
+			health := s.branchHealth[key]
+			if health == nil {
+				health = &branchHealth{}
+				s.branchHealth[key] = health
+				if !s.notifyPrimed {
+					switch {
+					case branch.BrokenSince != nil:
+						// Restored from the state file
+						health.broken = true
+						health.since, health.reminded = *branch.BrokenSince, now
+						health.brokenBy, health.brokenCommit = branch.BrokenBy, branch.BrokenCommit
+					case c == Red:
+						health.breaks(branch, now)
+					}
+					continue
+				}
+			}
+
+			event := ""
+			switch {
+			case c == Red && !health.broken:
+				event = BrokenEvent
+				health.breaks(branch, now)
+			case c == Green && health.broken:
+				event = FixedEvent
+				health.broken = false
+			case c == Red && s.StillFailingAfter > 0 && now.Sub(health.reminded) >= s.StillFailingAfter:
+				event = StillFailingEvent
+				health.reminded = now
+			}
+
+			if event != "" {
+				notifications = append(notifications, newNotification(event, project, branch, health, now))
+			}
+		}
+	}
+
+	for key := range s.branchHealth {
+		if !seen[key] {
+			delete(s.branchHealth, key)
+		}
+	}
+
+	return notifications
+}
+
+// annotateBroken sets who broke every broken branch of projects, which
+// must not be shared, and returns the culprits. s.mu must be held.
+func (s *Server) annotateBroken(projects []Project) []Culprit {
+	var culprits []Culprit
+
+	for i := range projects {
+		for j := range projects[i].Branches {
+			branch := &projects[i].Branches[j]
+			branch.BrokenBy, branch.BrokenCommit, branch.BrokenSince = "", "", nil
+
+			health := s.branchHealth[branchKey{projects[i].Name, branch.Name}]
+			if health == nil || !health.broken {
+				continue
+			}
+
+			since := health.since
+			branch.BrokenBy = health.brokenBy
+			branch.BrokenCommit = health.brokenCommit
+			branch.BrokenSince = &since
+
+			culprits = append(culprits, Culprit{
+				Project: projects[i].Name,
+				Branch:  branch.Name,
+				Author:  health.brokenBy,
+				Commit:  health.brokenCommit,
+				Since:   since,
+			})
+		}
+	}
+
+	return culprits
+}
+
+func newNotification(event string, project Project, branch Branch, health *branchHealth, now time.Time) Notification {
+	n := Notification{
+		Event:        event,
+		Project:      project.Name,
+		Branch:       branch.Name,
+		Commit:       branch.Commit,
+		URL:          project.URL,
+		Since:        health.since,
+		Time:         now,
+		BrokenBy:     health.brokenBy,
+		BrokenCommit: health.brokenCommit,
+	}
+
+	authors := make(map[string]bool)
+	for _, status := range branch.Statuses {
+		if status.failing() {
+			n.Failed = append(n.Failed, status.Name)
+		}
+		if status.Author != "" && (status.failing() || event == FixedEvent) {
+			authors[status.Author] = true
+		}
+	}
+	for author := range authors {
+		n.Authors = append(n.Authors, author)
+	}
+	sort.Strings(n.Authors)
+
+	return n
+}
+
+// startNotifiers starts delivering notifications to every subscription
+// until ctx is done
+func (s *Server) startNotifiers(ctx context.Context, wg *sync.WaitGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.Subscriptions {
+		sub.queue = make(chan Notification, notifyQueueSize)
+
+		wg.Add(1)
+		go func(sub *Subscription) {
+			defer wg.Done()
+			s.deliver(ctx, sub)
+		}(sub)
+	}
+}
+
+// queueNotifications hands the notifications to the matching subscriptions
+// without blocking. s.mu must be held.
+func (s *Server) queueNotifications(notifications []Notification) {
+	for _, n := range notifications {
+		s.Logger.Printf("Notification: %s\n", n)
+
+		for _, sub := range s.Subscriptions {
+			if sub.queue == nil || !sub.matches(n) {
+				continue
+			}
+
+			select {
+			case sub.queue <- n:
+			default:
+				s.Logger.Printf("Dropped notification to %s, too many are waiting\n", sub.Name)
+			}
+		}
+	}
+}
+
+// deliver sends the queued notifications of a subscription until ctx is
+// done
+func (s *Server) deliver(ctx context.Context, sub *Subscription) {
+	for {
+		select {
+		case n := <-sub.queue:
+			if !sub.allow(time.Now()) {
+				s.Logger.Printf("Dropped notification to %s, rate limit reached: %s\n", sub.Name, n)
+				continue
+			}
+
+			if sub.DryRun {
+				s.Logger.Printf("Dry run, not notifying %s: %s\n", sub.Name, n)
+				continue
+			}
+
+			err := notifyWithRetry(ctx, sub, n)
+			if err != nil {
+				s.Logger.Printf("Error notifying %s: %s\n", sub.Name, err)
+				continue
+			}
+			s.Logger.Printf("Notified %s: %s\n", sub.Name, n)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notifyWithRetry delivers a notification, retrying with an exponential
+// backoff until it succeeds, MaxRetryTime elapses or ctx is done
+func notifyWithRetry(ctx context.Context, sub *Subscription, n Notification) error {
+	expBackoff := backoff.NewExponentialBackOff()
+	expBackoff.MaxElapsedTime = sub.MaxRetryTime
+	if expBackoff.MaxElapsedTime <= 0 {
+		expBackoff.MaxElapsedTime = DefaultMaxRetryTime
+	}
+	expBackoff.Reset()
+
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, notifyAttemptTimeout)
+		err := sub.Notifier.Notify(attemptCtx, n)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		wait := expBackoff.NextBackOff()
+		if wait == backoff.Stop {
+			return err
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"tantalic.com/cistatus"
+)
+
+var testNotification = cistatus.Notification{
+	Event:        cistatus.BrokenEvent,
+	Project:      "api",
+	Branch:       "master",
+	Commit:       "0123456789abcdef",
+	URL:          "https://ci.example.com/api",
+	Failed:       []string{"test"},
+	Authors:      []string{"alice"},
+	Since:        time.Date(2017, 4, 11, 20, 0, 0, 0, time.UTC),
+	Time:         time.Date(2017, 4, 11, 20, 5, 0, 0, time.UTC),
+	BrokenBy:     "alice",
+	BrokenCommit: "0123456789abcdef",
+}
+
+// recorder is an HTTP server recording the last request it received
+type recorder struct {
+	*httptest.Server
+	requests chan recordedRequest
+}
+
+type recordedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newRecorder(status int, response string) *recorder {
+	r := &recorder{requests: make(chan recordedRequest, 1)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.requests <- recordedRequest{req.Header, body}
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	return r
+}
+
+func TestSlack(t *testing.T) {
+	server := newRecorder(http.StatusOK, "ok")
+	defer server.Close()
+
+	slack := NewSlack(server.URL)
+	slack.Channel = "#ci"
+	err := slack.Notify(context.Background(), testNotification)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-server.requests
+	var msg slackMessage
+	err = json.Unmarshal(req.body, &msg)
+	if err != nil {
+		t.Fatalf("invalid message %s: %s", req.body, err)
+	}
+
+	want := ":red_circle: api/master is broken: test failed <https://ci.example.com/api|api>\nBroken by alice in 01234567"
+	if msg.Text != want {
+		t.Errorf("text %q, want %q", msg.Text, want)
+	}
+	if msg.Channel != "#ci" || msg.Username != "" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("content type %q", got)
+	}
+}
+
+func TestSlackEscape(t *testing.T) {
+	n := testNotification
+	n.Project = "<api>"
+	n.URL = ""
+	n.BrokenBy = ""
+	n.Authors = []string{"a&b"}
+
+	want := ":red_circle: &lt;api&gt;/master is broken: test failed\nCommit 01234567 by a&amp;b"
+	if got := slackText(n); got != want {
+		t.Errorf("text %q, want %q", got, want)
+	}
+}
+
+func TestSlackRejected(t *testing.T) {
+	server := newRecorder(http.StatusNotFound, "no_service\n")
+	defer server.Close()
+
+	err := NewSlack(server.URL).Notify(context.Background(), testNotification)
+	if err == nil || !strings.Contains(err.Error(), "status 404: no_service") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	server := newRecorder(http.StatusNoContent, "")
+	defer server.Close()
+
+	webhook := NewWebhook(server.URL)
+	webhook.Header.Set("X-Token", "secret")
+	err := webhook.Notify(context.Background(), testNotification)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-server.requests
+	var got cistatus.Notification
+	err = json.Unmarshal(req.body, &got)
+	if err != nil {
+		t.Fatalf("invalid notification %s: %s", req.body, err)
+	}
+	if got.Project != "api" || got.Event != cistatus.BrokenEvent || !got.Time.Equal(testNotification.Time) {
+		t.Errorf("unexpected notification %+v", got)
+	}
+	if req.header.Get("X-Token") != "secret" {
+		t.Errorf("header not sent: %v", req.header)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	server := newRecorder(http.StatusOK, "")
+	defer server.Close()
+
+	tmpl, err := ParseTemplate(`{"message": {{json .Text}}, "project": {{json .Project}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := NewWebhook(server.URL)
+	webhook.Header.Set("Content-Type", "text/plain")
+	webhook.Template = tmpl
+	err = webhook.Notify(context.Background(), testNotification)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-server.requests
+	want := `{"message": "api/master is broken: test failed", "project": "api"}`
+	if string(req.body) != want {
+		t.Errorf("body %s, want %s", req.body, want)
+	}
+	if got := req.header.Get("Content-Type"); got != "text/plain" {
+		t.Errorf("content type %q", got)
+	}
+}
+
+func TestWebhookCancelled(t *testing.T) {
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blocked
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := NewWebhook(server.URL).Notify(ctx, testNotification)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// smtpServer is a minimal SMTP server accepting a single message
+type smtpServer struct {
+	listener net.Listener
+	messages chan smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &smtpServer{
+		listener: listener,
+		messages: make(chan smtpMessage, 1),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	var msg smtpMessage
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			msg.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			text.PrintfLine("250 OK")
+		case command == "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := ioutil.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			text.PrintfLine("250 OK")
+			s.messages <- msg
+		case command == "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	server := newSMTPServer(t)
+	defer server.listener.Close()
+
+	mailer := NewSMTP(server.listener.Addr().String(), "ci@example.com", "alice@example.com", "bob@example.com")
+	err := mailer.Notify(context.Background(), testNotification)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-server.messages
+	if msg.from != "ci@example.com" {
+		t.Errorf("from %q", msg.from)
+	}
+	if strings.Join(msg.to, ",") != "alice@example.com,bob@example.com" {
+		t.Errorf("to %q", msg.to)
+	}
+
+	for _, want := range []string{
+		"To: alice@example.com, bob@example.com\n",
+		"Subject: [cistatus] api/master is broken: test failed\n",
+		"Date: Tue, 11 Apr 2017 20:05:00 +0000\n",
+		"Failed: test\n",
+		"Broken by: alice in 01234567\n",
+		"\nhttps://ci.example.com/api\n",
+	} {
+		if !strings.Contains(msg.data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, msg.data)
+		}
+	}
+}
+
+func TestSMTPUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	err = NewSMTP(addr, "ci@example.com", "alice@example.com").Notify(context.Background(), testNotification)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestHeaderValue(t *testing.T) {
+	if got := headerValue("a\r\nBcc: b"); got != "a  Bcc: b" {
+		t.Errorf("header value %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"tantalic.com/cistatus"
+)
+
+// Slack posts notifications to a Slack compatible incoming webhook. Channel
+// and Username, when set, override the defaults of the webhook.
+type Slack struct {
+	HTTPClient http.Client
+	URL        string
+	Channel    string
+	Username   string
+}
+
+// NewSlack creates a Slack notifier posting to the incoming webhook url
+func NewSlack(url string) *Slack {
+	return &Slack{
+		URL: url,
+	}
+}
+
+type slackMessage struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// Notify posts the notification as a message
+func (s *Slack) Notify(ctx context.Context, n cistatus.Notification) error {
+	body, err := json.Marshal(slackMessage{
+		Text:     slackText(n),
+		Channel:  s.Channel,
+		Username: s.Username,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to encode message")
+	}
+
+	return post(ctx, &s.HTTPClient, s.URL, nil, body)
+}
+
+// slackText formats the notification with an icon for the event and a
+// link to the project
+func slackText(n cistatus.Notification) string {
+	icon := ":warning:"
+	switch n.Event {
+	case cistatus.BrokenEvent:
+		icon = ":red_circle:"
+	case cistatus.FixedEvent:
+		icon = ":white_check_mark:"
+	}
+
+	text := icon + " " + slackEscape(n.String())
+	if n.URL != "" {
+		text += " <" + n.URL + "|" + slackEscape(n.Project) + ">"
+	}
+	switch {
+	case n.BrokenBy != "":
+		text += "\nBroken by " + slackEscape(n.BrokenBy) + " in " + slackEscape(shortCommit(n.BrokenCommit))
+	case len(n.Authors) > 0 && n.Event != cistatus.FixedEvent:
+		text += "\nCommit " + slackEscape(shortCommit(n.Commit)) + " by " + slackEscape(joinAuthors(n.Authors))
+	}
+
+	return text
+}
+
+// slackEscape escapes the characters Slack reserves for links and mentions
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
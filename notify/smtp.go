@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"tantalic.com/cistatus"
+)
+
+// SMTP emails notifications through the server at Addr (host:port). The
+// connection is upgraded with STARTTLS when the server supports it and
+// authenticated with PLAIN when Username is set.
+type SMTP struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// NewSMTP creates an SMTP notifier sending from one address to others
+func NewSMTP(addr, from string, to ...string) *SMTP {
+	return &SMTP{
+		Addr: addr,
+		From: from,
+		To:   to,
+	}
+}
+
+// Notify emails the notification
+func (m *SMTP) Notify(ctx context.Context, n cistatus.Notification) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return errors.Wrap(err, "invalid SMTP address")
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	msg := m.message(n)
+
+	// net/smtp does not support contexts, a cancelled delivery is abandoned
+	// and left to finish in the background
+	result := make(chan error, 1)
+	go func() {
+		result <- smtp.SendMail(m.Addr, auth, m.From, m.To, msg)
+	}()
+
+	select {
+	case err := <-result:
+		return errors.Wrap(err, "unable to send email")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// message formats the notification as a plain text email
+func (m *SMTP) message(n cistatus.Notification) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: [cistatus] %s\r\n", headerValue(n.String()))
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	fmt.Fprintf(&b, "%s\r\n\r\n", n)
+	fmt.Fprintf(&b, "Project: %s\r\n", n.Project)
+	fmt.Fprintf(&b, "Branch: %s\r\n", n.Branch)
+	if n.Commit != "" {
+		fmt.Fprintf(&b, "Commit: %s\r\n", n.Commit)
+	}
+	if len(n.Failed) > 0 {
+		fmt.Fprintf(&b, "Failed: %s\r\n", strings.Join(n.Failed, ", "))
+	}
+	if len(n.Authors) > 0 {
+		fmt.Fprintf(&b, "Authors: %s\r\n", joinAuthors(n.Authors))
+	}
+	if n.BrokenBy != "" {
+		fmt.Fprintf(&b, "Broken by: %s in %s\r\n", n.BrokenBy, shortCommit(n.BrokenCommit))
+	}
+	fmt.Fprintf(&b, "Broken since: %s\r\n", n.Since.Format(time.RFC1123Z))
+	if n.URL != "" {
+		fmt.Fprintf(&b, "\r\n%s\r\n", n.URL)
+	}
+
+	return b.Bytes()
+}
+
+// headerValue removes line breaks that would end a header
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"tantalic.com/cistatus"
+)
+
+// Webhook posts notifications to a URL. The body is the notification as
+// JSON unless Template is set, in which case it is the template executed
+// with the notification. Header is added to every request.
+type Webhook struct {
+	HTTPClient http.Client
+	URL        string
+	Header     http.Header
+	Template   *template.Template
+}
+
+// NewWebhook creates a Webhook notifier posting JSON to url
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Header: make(http.Header),
+	}
+}
+
+// ParseTemplate parses a body template for a Webhook. Besides the fields of
+// the notification, templates can use the json function to encode any value
+// and text for the description of the notification, for example:
+//
+//	{"message": {{json .Text}}, "project": {{json .Project}}}
+func ParseTemplate(text string) (*template.Template, error) {
+	t, err := template.New("body").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid webhook template")
+	}
+	return t, nil
+}
+
+// templateData is what body templates are executed with
+type templateData struct {
+	cistatus.Notification
+	Text string
+}
+
+// Notify posts the notification
+func (w *Webhook) Notify(ctx context.Context, n cistatus.Notification) error {
+	var body []byte
+	if w.Template == nil {
+		var err error
+		body, err = json.Marshal(n)
+		if err != nil {
+			return errors.Wrap(err, "unable to encode notification")
+		}
+	} else {
+		var b bytes.Buffer
+		err := w.Template.Execute(&b, templateData{n, n.String()})
+		if err != nil {
+			return errors.Wrap(err, "unable to execute webhook template")
+		}
+		body = b.Bytes()
+	}
+
+	return post(ctx, &w.HTTPClient, w.URL, w.Header, body)
+}
@@ -0,0 +1,231 @@
+package cistatus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingNotifier fails the first failures deliveries and counts them all
+type countingNotifier struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (n *countingNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.attempts++
+	if n.attempts <= n.failures {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func (n *countingNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.attempts
+}
+
+func TestNotifyWithRetry(t *testing.T) {
+	notifier := &countingNotifier{failures: 2}
+	sub := &Subscription{Notifier: notifier, MaxRetryTime: 10 * time.Second}
+
+	err := notifyWithRetry(context.Background(), sub, Notification{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notifier.count() != 3 {
+		t.Errorf("%d attempts, want 3", notifier.count())
+	}
+}
+
+func TestNotifyWithRetryGivesUp(t *testing.T) {
+	notifier := &countingNotifier{failures: 1000}
+	sub := &Subscription{Notifier: notifier, MaxRetryTime: time.Second}
+
+	start := time.Now()
+	err := notifyWithRetry(context.Background(), sub, Notification{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retried for %s", elapsed)
+	}
+	if notifier.count() < 2 {
+		t.Errorf("%d attempts, want a retry", notifier.count())
+	}
+}
+
+func TestNotifyWithRetryCancelled(t *testing.T) {
+	notifier := &countingNotifier{failures: 1000}
+	sub := &Subscription{Notifier: notifier}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := notifyWithRetry(ctx, sub, Notification{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if notifier.count() != 1 {
+		t.Errorf("%d attempts after cancellation, want 1", notifier.count())
+	}
+}
+
+func TestSubscriptionAllow(t *testing.T) {
+	sub := &Subscription{RateLimit: 2, RatePeriod: time.Minute}
+	now := time.Now()
+
+	for i, want := range []bool{true, true, false} {
+		if got := sub.allow(now.Add(time.Duration(i) * time.Second)); got != want {
+			t.Errorf("notification %d allowed %t, want %t", i, got, want)
+		}
+	}
+
+	if !sub.allow(now.Add(time.Minute)) {
+		t.Error("not allowed once the first notification left the period")
+	}
+	if sub.allow(now.Add(time.Minute + 500*time.Millisecond)) {
+		t.Error("allowed beyond the limit")
+	}
+
+	unlimited := &Subscription{}
+	for i := 0; i < 100; i++ {
+		if !unlimited.allow(now) {
+			t.Fatal("a subscription without rate limit dropped a notification")
+		}
+	}
+}
+
+// deliverAll runs deliver for sub until every notification was handled
+func deliverAll(s *Server, sub *Subscription, notifications ...Notification) {
+	// Each send of the unbuffered queue waits for the previous
+	// notification to be handled
+	sub.queue = make(chan Notification)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.deliver(ctx, sub)
+		close(done)
+	}()
+
+	for _, n := range notifications {
+		sub.queue <- n
+	}
+	cancel()
+	<-done
+}
+
+func TestDeliverRateLimit(t *testing.T) {
+	var logs bytes.Buffer
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.Logger = log.New(&logs, "", 0)
+
+	notifier := &countingNotifier{}
+	sub := &Subscription{Name: "chat", Notifier: notifier, RateLimit: 1, RatePeriod: time.Hour}
+	deliverAll(s, sub, Notification{Project: "api"}, Notification{Project: "web"}, Notification{Project: "db"})
+
+	if notifier.count() != 1 {
+		t.Errorf("%d notifications sent, want 1", notifier.count())
+	}
+	if got := strings.Count(logs.String(), "Dropped notification to chat, rate limit reached"); got != 2 {
+		t.Errorf("%d notifications dropped, want 2:\n%s", got, logs.String())
+	}
+}
+
+func TestDeliverDryRun(t *testing.T) {
+	var logs bytes.Buffer
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.Logger = log.New(&logs, "", 0)
+
+	notifier := &countingNotifier{}
+	sub := &Subscription{Name: "chat", Notifier: notifier, DryRun: true}
+	deliverAll(s, sub, Notification{Event: BrokenEvent, Project: "api", Branch: "master", Failed: []string{"test"}})
+
+	if notifier.count() != 0 {
+		t.Errorf("%d notifications sent in dry run", notifier.count())
+	}
+	if want := "Dry run, not notifying chat: api/master is broken: test failed"; !strings.Contains(logs.String(), want) {
+		t.Errorf("log does not contain %q:\n%s", want, logs.String())
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	sub := &Subscription{
+		Branches: map[string]bool{"master": true},
+		Events:   map[string]bool{BrokenEvent: true},
+	}
+
+	tests := []struct {
+		n    Notification
+		want bool
+	}{
+		{Notification{Event: BrokenEvent, Project: "api", Branch: "master"}, true},
+		{Notification{Event: FixedEvent, Project: "api", Branch: "master"}, false},
+		{Notification{Event: BrokenEvent, Project: "api", Branch: "develop"}, false},
+	}
+
+	for _, test := range tests {
+		if got := sub.matches(test.n); got != test.want {
+			t.Errorf("%+v matches %t, want %t", test.n, got, test.want)
+		}
+	}
+}
+
+func TestBrokenByFirstFailingCommit(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	start := time.Now().Add(-time.Hour)
+
+	rebuild := func(at time.Time, commit string, statuses ...Status) []Culprit {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.fetchedProjects = []Project{{Name: "api", Branches: []Branch{{Name: "master", Commit: commit, Statuses: statuses}}}}
+		s.rebuildSummary(at)
+		s.notifyPrimed = true
+		return s.latestSummary.Culprits
+	}
+
+	if culprits := rebuild(start, "abc", Status{Name: "test", Status: "success", Author: "alice"}); len(culprits) != 0 {
+		t.Fatalf("green branch has culprits %+v", culprits)
+	}
+
+	// The earliest failing job of the commit names the culprit
+	brokenAt := start.Add(5 * time.Minute)
+	culprits := rebuild(start.Add(10*time.Minute), "def",
+		Status{Name: "lint", Status: "failed", Author: "carol", Created: brokenAt.Add(time.Minute)},
+		Status{Name: "test", Status: "failed", Author: "bob", Created: brokenAt},
+	)
+	want := Culprit{Project: "api", Branch: "master", Author: "bob", Commit: "def", Since: brokenAt}
+	if len(culprits) != 1 || culprits[0] != want {
+		t.Fatalf("culprits %+v, want %+v", culprits, want)
+	}
+
+	// Later commits failing too do not move the blame
+	culprits = rebuild(start.Add(20*time.Minute), "ghi",
+		Status{Name: "test", Status: "failed", Author: "dave", Created: start.Add(15 * time.Minute)},
+	)
+	if len(culprits) != 1 || culprits[0] != want {
+		t.Errorf("culprits %+v after another failing commit, want %+v", culprits, want)
+	}
+
+	summary := s.summary()
+	branch := summary.Projects[0].Branches[0]
+	if branch.BrokenBy != "bob" || branch.BrokenCommit != "def" || branch.BrokenSince == nil || !branch.BrokenSince.Equal(brokenAt) {
+		t.Errorf("branch not annotated: %+v", branch)
+	}
+
+	if culprits := rebuild(start.Add(30*time.Minute), "jkl", Status{Name: "test", Status: "success", Author: "bob"}); len(culprits) != 0 {
+		t.Errorf("fixed branch has culprits %+v", culprits)
+	}
+}
@@ -0,0 +1,278 @@
+package relay
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+
+	"tantalic.com/cistatus"
+)
+
+const (
+	// Separator joins the zone and the remote project name. It is not a
+	// slash so that relayed projects stay a single segment of the paths of
+	// the project resources and badges.
+	Separator = ":"
+
+	// unreachableName is the name of the branch and status of the project
+	// standing in for an upstream that was never reached
+	unreachableName = "unreachable"
+)
+
+// Upstream is a remote cistatusserver whose projects are relayed with the
+// zone name as a prefix
+type Upstream struct {
+	Zone   string
+	Client *cistatus.Client
+
+	mu       sync.Mutex
+	summary  *cistatus.Summary
+	watching bool
+}
+
+// NewUpstream creates an Upstream for the server at rawurl, such as
+// https://status.zone-a.example.com:8443. A username in the URL, such as
+// https://TOKEN@status.example.com, is used as the JWT sent to the server.
+func NewUpstream(zone, rawurl string) (*Upstream, error) {
+	if zone == "" {
+		return nil, errors.New("zone is required")
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid upstream URL %q", rawurl)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("invalid upstream URL %q: scheme must be http or https", rawurl)
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		return nil, errors.Errorf("invalid upstream URL %q: path is not supported", rawurl)
+	}
+
+	client := &cistatus.Client{
+		Hostname: u.Hostname(),
+		UseTLS:   u.Scheme == "https",
+	}
+
+	if u.Port() != "" {
+		client.Port, err = strconv.Atoi(u.Port())
+		if err != nil {
+			return nil, errors.Errorf("invalid upstream URL %q: invalid port", rawurl)
+		}
+	}
+
+	if u.User != nil {
+		client.Token = u.User.Username()
+	}
+
+	return &Upstream{
+		Zone:   zone,
+		Client: client,
+	}, nil
+}
+
+// setSummary records the latest summary received from the upstream
+func (u *Upstream) setSummary(summary *cistatus.Summary) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.summary = summary
+}
+
+// setWatching records whether the upstream is currently subscribed to
+func (u *Upstream) setWatching(watching bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.watching = watching
+}
+
+type Relay struct {
+	Upstreams []*Upstream
+}
+
+// NewRelay creates a Fetcher that aggregates the projects of other
+// cistatusservers
+func NewRelay(upstreams ...*Upstream) *Relay {
+	return &Relay{
+		Upstreams: upstreams,
+	}
+}
+
+// FetchStatus fetches the summary of every upstream concurrently. When an
+// upstream cannot be fetched the summary most recently received by Watch is
+// used instead, if still subscribed. Otherwise the upstream is unreachable
+// and the projects last received from it are reported with every status
+// unknown, or a project named after the zone with an unknown status when
+// nothing was ever received. Unreachable upstreams do not fail the fetch.
+func (r *Relay) FetchStatus(ctx context.Context) ([]cistatus.Project, error) {
+	results := make([][]cistatus.Project, len(r.Upstreams))
+
+	var wg sync.WaitGroup
+	for i, upstream := range r.Upstreams {
+		wg.Add(1)
+		go func(i int, upstream *Upstream) {
+			defer wg.Done()
+			results[i] = upstream.fetch(ctx)
+		}(i, upstream)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var projects []cistatus.Project
+	for _, result := range results {
+		projects = append(projects, result...)
+	}
+
+	return projects, nil
+}
+
+func (u *Upstream) fetch(ctx context.Context) []cistatus.Project {
+	summary, err := u.Client.Summary(ctx)
+	if err == nil {
+		u.setSummary(summary)
+		return prefixProjects(u.Zone, summary.Projects, false)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.watching && u.summary != nil {
+		return prefixProjects(u.Zone, u.summary.Projects, false)
+	}
+
+	if u.summary == nil {
+		return []cistatus.Project{unreachableProject(u.Zone)}
+	}
+
+	return prefixProjects(u.Zone, u.summary.Projects, true)
+}
+
+// Watch subscribes to every upstream, reconnecting with an exponential
+// backoff, and sends a value whenever a summary is received or a
+// subscription is lost.
+func (r *Relay) Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, upstream := range r.Upstreams {
+		wg.Add(1)
+		go func(upstream *Upstream) {
+			defer wg.Done()
+			upstream.watch(ctx, notify)
+		}(upstream)
+	}
+
+	go func() {
+		wg.Wait()
+		close(changes)
+	}()
+
+	return changes
+}
+
+func (u *Upstream) watch(ctx context.Context, notify func()) {
+	expBackoff := backoff.ExponentialBackOff{
+		InitialInterval:     1 * time.Second,
+		RandomizationFactor: 0.3,
+		Multiplier:          1.5,
+		MaxInterval:         5 * time.Minute,
+		MaxElapsedTime:      0,
+		Clock:               backoff.SystemClock,
+	}
+	expBackoff.Reset()
+
+	for {
+		summaries := make(chan cistatus.Summary)
+		watchDone := make(chan error, 1)
+		go func() {
+			watchDone <- u.Client.WatchContext(ctx, summaries)
+		}()
+
+	receive:
+		for {
+			select {
+			case summary := <-summaries:
+				u.setSummary(&summary)
+				u.setWatching(true)
+				expBackoff.Reset()
+				notify()
+			case <-watchDone:
+				break receive
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		u.setWatching(false)
+		notify()
+
+		select {
+		case <-time.After(expBackoff.NextBackOff()):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// prefixProjects returns a copy of projects with the zone prefixed to each
+// name. When unreachable is set every status is unknown.
+func prefixProjects(zone string, projects []cistatus.Project, unreachable bool) []cistatus.Project {
+	prefixed := make([]cistatus.Project, len(projects))
+
+	for i, project := range projects {
+		project.Name = strings.Join([]string{zone, project.Name}, Separator)
+
+		if unreachable {
+			branches := make([]cistatus.Branch, len(project.Branches))
+			for j, branch := range project.Branches {
+				statuses := make([]cistatus.Status, len(branch.Statuses))
+				for k, status := range branch.Statuses {
+					status.Status = cistatus.UnknownStatus
+					statuses[k] = status
+				}
+				branch.Statuses = statuses
+				branches[j] = branch
+			}
+			project.Branches = branches
+		}
+
+		prefixed[i] = project
+	}
+
+	return prefixed
+}
+
+// unreachableProject stands in for the projects of an upstream that was
+// never reached so that the zone is not silently missing
+func unreachableProject(zone string) cistatus.Project {
+	return cistatus.Project{
+		Name: zone,
+		Branches: []cistatus.Branch{{
+			Name: unreachableName,
+			Statuses: []cistatus.Status{{
+				Name:   unreachableName,
+				Status: cistatus.UnknownStatus,
+			}},
+		}},
+	}
+}
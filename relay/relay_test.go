@@ -0,0 +1,99 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tantalic.com/cistatus"
+)
+
+func newUpstreamServer(summary cistatus.Summary) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(summary)
+	}))
+}
+
+// unusedURL returns the URL of a port nothing listens on
+func unusedURL(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	return "http://" + listener.Addr().String()
+}
+
+func newTestUpstream(t *testing.T, zone, rawurl string) *Upstream {
+	upstream, err := NewUpstream(zone, rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return upstream
+}
+
+func TestFetchStatus(t *testing.T) {
+	server := newUpstreamServer(cistatus.Summary{Projects: []cistatus.Project{{
+		Name:     "api",
+		Branches: []cistatus.Branch{{Name: "master", Statuses: []cistatus.Status{{Name: "test", Status: "success"}}}},
+	}}})
+
+	reachable := newTestUpstream(t, "zone-a", server.URL)
+	relay := NewRelay(reachable, newTestUpstream(t, "zone-b", unusedURL(t)))
+
+	projects, err := relay.FetchStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 2 {
+		t.Fatalf("unexpected projects %+v", projects)
+	}
+
+	if projects[0].Name != "zone-a:api" || projects[0].Branches[0].Statuses[0].Status != "success" {
+		t.Errorf("unexpected relayed project %+v", projects[0])
+	}
+
+	placeholder := projects[1]
+	if placeholder.Name != "zone-b" || len(placeholder.Branches) != 1 || len(placeholder.Branches[0].Statuses) != 1 {
+		t.Fatalf("unexpected project for an upstream never reached %+v", placeholder)
+	}
+	if status := placeholder.Branches[0].Statuses[0]; status.Status != cistatus.UnknownStatus {
+		t.Errorf("status %q of an upstream never reached, want %q", status.Status, cistatus.UnknownStatus)
+	}
+
+	// Once the upstream is lost its last projects are reported unknown
+	server.Close()
+	projects, err = NewRelay(reachable).FetchStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0].Name != "zone-a:api" {
+		t.Fatalf("unexpected projects %+v", projects)
+	}
+	if status := projects[0].Branches[0].Statuses[0]; status.Status != cistatus.UnknownStatus {
+		t.Errorf("status %q of an unreachable upstream, want %q", status.Status, cistatus.UnknownStatus)
+	}
+}
+
+func TestPrefixProjectsCopies(t *testing.T) {
+	projects := []cistatus.Project{{
+		Name:     "api",
+		Branches: []cistatus.Branch{{Name: "master", Statuses: []cistatus.Status{{Name: "test", Status: "failed"}}}},
+	}}
+
+	prefixed := prefixProjects("zone-a", projects, true)
+	if prefixed[0].Name != "zone-a:api" || prefixed[0].Branches[0].Statuses[0].Status != cistatus.UnknownStatus {
+		t.Errorf("unexpected projects %+v", prefixed)
+	}
+	if projects[0].Name != "api" || projects[0].Branches[0].Statuses[0].Status != "failed" {
+		t.Errorf("the original projects were modified: %+v", projects)
+	}
+}
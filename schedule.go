@@ -0,0 +1,292 @@
+package cistatus
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of Window
+const (
+	QuietKind       = "quiet"
+	MaintenanceKind = "maintenance"
+)
+
+// Window is the quiet hours or maintenance window in effect. While a window
+// is in effect the summary color is Off or Maintenance and notifications are
+// held until it ends.
+type Window struct {
+	Kind    string    `json:"kind"`
+	Comment string    `json:"comment,omitempty"`
+	Until   time.Time `json:"until"`
+}
+
+// color is the color shown while the window is in effect
+func (w Window) color() Color {
+	if w.Kind == MaintenanceKind {
+		return Maintenance
+	}
+	return Off
+}
+
+// QuietHours are the hours of every day, and the whole days of the week,
+// during which the summary color is Off. Start and End are times of day as
+// offsets from midnight in Location; an End before Start spans midnight and
+// an End equal to Start means there are only quiet days.
+type QuietHours struct {
+	Start    time.Duration
+	End      time.Duration
+	Days     []time.Weekday
+	Location *time.Location
+}
+
+// ParseQuietHours parses quiet hours such as "19:00-07:00", quiet days such
+// as "sat,sun" and the name of a time zone such as "Europe/Berlin". Either
+// hours or days may be empty; the time zone is local when empty.
+func ParseQuietHours(hours, days, zone string) (*QuietHours, error) {
+	q := &QuietHours{Location: time.Local}
+
+	if hours != "" {
+		parts := strings.SplitN(hours, "-", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid quiet hours %q, expected start-end such as 19:00-07:00", hours)
+		}
+
+		var err error
+		q.Start, err = parseTimeOfDay(parts[0])
+		if err == nil {
+			q.End, err = parseTimeOfDay(parts[1])
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid quiet hours %q", hours)
+		}
+	}
+
+	for _, day := range strings.Split(days, ",") {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if day == "" {
+			continue
+		}
+
+		weekday, ok := weekdays[day]
+		if !ok {
+			return nil, errors.Errorf("invalid quiet day %q", day)
+		}
+		q.Days = append(q.Days, weekday)
+	}
+
+	if zone != "" {
+		var err error
+		q.Location, err = time.LoadLocation(zone)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid time zone %q", zone)
+		}
+	}
+
+	return q, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseTimeOfDay parses hh:mm, where 24:00 is the end of the day
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), ":", 2)
+	if len(parts) != 2 {
+		return 0, errors.Errorf("expected hh:mm, got %q", value)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, errors.Errorf("expected hh:mm, got %q", value)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, errors.Errorf("expected hh:mm, got %q", value)
+	}
+
+	d := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+	if hour < 0 || minute < 0 || minute > 59 || d > 24*time.Hour {
+		return 0, errors.Errorf("expected hh:mm, got %q", value)
+	}
+
+	return d, nil
+}
+
+// active reports whether t is within the quiet hours
+func (q *QuietHours) active(t time.Time) bool {
+	t = t.In(q.Location)
+	for _, day := range q.Days {
+		if t.Weekday() == day {
+			return true
+		}
+	}
+
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	switch {
+	case q.Start == q.End:
+		return false
+	case q.Start < q.End:
+		return d >= q.Start && d < q.End
+	default:
+		return d >= q.Start || d < q.End
+	}
+}
+
+// next returns the first time after t at which the quiet hours may start or
+// end
+func (q *QuietHours) next(t time.Time) time.Time {
+	local := t.In(q.Location)
+	year, month, day := local.Date()
+
+	// The next midnight is always a candidate, so today and tomorrow are
+	// enough. Times of day are set on the date rather than added to
+	// midnight so they stay on the wall clock across daylight saving
+	// changes.
+	var next time.Time
+	for i := 0; i < 2; i++ {
+		for _, offset := range []time.Duration{0, q.Start, q.End} {
+			b := time.Date(year, month, day+i, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, q.Location)
+			if b.After(t) && (next.IsZero() || b.Before(next)) {
+				next = b
+			}
+		}
+	}
+	return next
+}
+
+// until returns when the quiet hours that t is within end
+func (q *QuietHours) until(t time.Time) time.Time {
+	// Quiet hours on every day of the week never end, give up after a week
+	limit := t.AddDate(0, 0, 8)
+	for t.Before(limit) {
+		t = q.next(t)
+		if !q.active(t) {
+			return t
+		}
+	}
+	return t
+}
+
+// activeWindow returns the window in effect at now, nil when there is none.
+// Maintenance windows take precedence over quiet hours. s.mu must be held.
+func (s *Server) activeWindow(now time.Time) *Window {
+	var window *Window
+	for _, m := range s.maintenance {
+		if m.activeAt(now) && (window == nil || m.End.After(window.Until)) {
+			window = &Window{
+				Kind:    MaintenanceKind,
+				Comment: m.Comment,
+				Until:   m.End,
+			}
+		}
+	}
+	if window != nil {
+		return window
+	}
+
+	if s.QuietHours != nil && s.QuietHours.active(now) {
+		return &Window{
+			Kind:  QuietKind,
+			Until: s.QuietHours.until(now),
+		}
+	}
+
+	return nil
+}
+
+// scheduleWindowChange arranges for the summary to be rebuilt when the next
+// quiet hours or maintenance window starts or ends. s.mu must be held.
+func (s *Server) scheduleWindowChange(now time.Time) {
+	var next time.Time
+	if s.QuietHours != nil {
+		next = s.QuietHours.next(now)
+	}
+	for _, m := range s.maintenance {
+		for _, b := range []time.Time{m.Start, m.End} {
+			if b.After(now) && (next.IsZero() || b.Before(next)) {
+				next = b
+			}
+		}
+	}
+
+	if s.windowTimer != nil {
+		s.windowTimer.Stop()
+		s.windowTimer = nil
+	}
+	if next.IsZero() {
+		return
+	}
+
+	s.windowTimer = time.AfterFunc(next.Sub(now), s.windowChanged)
+}
+
+// windowChanged rebuilds and broadcasts the summary when a window starts or
+// ends
+func (s *Server) windowChanged() {
+	now := time.Now()
+
+	s.mu.Lock()
+	s.maintenance = endMaintenance(s.maintenance, now)
+	changed := s.rebuildSummary(now)
+	s.scheduleWindowChange(now)
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	if changed {
+		if summary.Window != nil {
+			s.Logger.Printf("Entered %s window until %s\n", summary.Window.Kind, summary.Window.Until)
+		} else {
+			s.Logger.Println("Left quiet hours or maintenance window")
+		}
+		s.publish(summary)
+	}
+}
+
+// holdNotifications adds notifications to the ones held during a window.
+// They are coalesced per branch, so a branch that breaks and is fixed
+// within a window is not reported at all. s.mu must be held.
+func (s *Server) holdNotifications(notifications []Notification) {
+	for _, n := range notifications {
+		held := -1
+		for i, h := range s.heldNotifications {
+			if h.Project == n.Project && h.Branch == n.Branch {
+				held = i
+				break
+			}
+		}
+
+		switch {
+		case held < 0:
+			s.heldNotifications = append(s.heldNotifications, n)
+		case s.heldNotifications[held].Event == BrokenEvent && n.Event == FixedEvent:
+			s.heldNotifications = append(s.heldNotifications[:held], s.heldNotifications[held+1:]...)
+		case s.heldNotifications[held].Event == BrokenEvent && n.Event == StillFailingEvent:
+			// Still reported as broken when the window ends
+		default:
+			s.heldNotifications[held] = n
+		}
+	}
+}
+
+// releaseNotifications queues the notifications held during a window.
+// s.mu must be held.
+func (s *Server) releaseNotifications() {
+	held := s.heldNotifications
+	s.heldNotifications = nil
+
+	sort.SliceStable(held, func(i, j int) bool {
+		return held[i].Time.Before(held[j].Time)
+	})
+	s.queueNotifications(held)
+}
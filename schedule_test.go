@@ -0,0 +1,149 @@
+package cistatus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	q, err := ParseQuietHours("19:00-07:30", "sat, Sunday", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Start != 19*time.Hour || q.End != 7*time.Hour+30*time.Minute {
+		t.Errorf("hours %s-%s", q.Start, q.End)
+	}
+	if len(q.Days) != 2 || q.Days[0] != time.Saturday || q.Days[1] != time.Sunday {
+		t.Errorf("days %v", q.Days)
+	}
+	if q.Location != time.UTC {
+		t.Errorf("location %s", q.Location)
+	}
+
+	for _, test := range [][3]string{
+		{"19:00", "", ""},
+		{"19:00-25:00", "", ""},
+		{"19:60-07:00", "", ""},
+		{"7pm-7am", "", ""},
+		{"", "someday", ""},
+		{"", "", "Nowhere/Nothing"},
+	} {
+		_, err := ParseQuietHours(test[0], test[1], test[2])
+		if err == nil {
+			t.Errorf("%q: expected an error", test)
+		}
+	}
+}
+
+func TestQuietHoursActive(t *testing.T) {
+	q, err := ParseQuietHours("19:00-07:00", "sun", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2017-04-10 is a Monday
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{time.Date(2017, 4, 10, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2017, 4, 10, 18, 59, 0, 0, time.UTC), false},
+		{time.Date(2017, 4, 10, 19, 0, 0, 0, time.UTC), true},
+		{time.Date(2017, 4, 11, 3, 0, 0, 0, time.UTC), true},
+		{time.Date(2017, 4, 11, 7, 0, 0, 0, time.UTC), false},
+		{time.Date(2017, 4, 16, 12, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, test := range tests {
+		if got := q.active(test.t); got != test.want {
+			t.Errorf("%s: active %t, want %t", test.t, got, test.want)
+		}
+	}
+
+	days, err := ParseQuietHours("", "sat", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days.active(time.Date(2017, 4, 10, 3, 0, 0, 0, time.UTC)) {
+		t.Error("quiet days without hours active on a weekday")
+	}
+}
+
+func TestQuietHoursUntil(t *testing.T) {
+	q, err := ParseQuietHours("19:00-07:00", "sat,sun", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		t, want time.Time
+	}{
+		// Monday evening until Tuesday morning
+		{time.Date(2017, 4, 10, 20, 0, 0, 0, time.UTC), time.Date(2017, 4, 11, 7, 0, 0, 0, time.UTC)},
+		// Friday evening through the weekend until Monday morning
+		{time.Date(2017, 4, 14, 20, 0, 0, 0, time.UTC), time.Date(2017, 4, 17, 7, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		if got := q.until(test.t); !got.Equal(test.want) {
+			t.Errorf("%s: until %s, want %s", test.t, got, test.want)
+		}
+	}
+
+	if got, want := q.next(time.Date(2017, 4, 10, 12, 0, 0, 0, time.UTC)), time.Date(2017, 4, 10, 19, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next %s, want %s", got, want)
+	}
+}
+
+func TestActiveWindow(t *testing.T) {
+	q, err := ParseQuietHours("19:00-07:00", "", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.QuietHours = q
+
+	evening := time.Date(2017, 4, 10, 20, 0, 0, 0, time.UTC)
+	if w := s.activeWindow(evening); w == nil || w.Kind != QuietKind {
+		t.Errorf("unexpected window %+v during quiet hours", w)
+	}
+	if w := s.activeWindow(evening.Add(-6 * time.Hour)); w != nil {
+		t.Errorf("unexpected window %+v outside quiet hours", w)
+	}
+
+	s.maintenance = []MaintenanceWindow{
+		{Start: evening.Add(-time.Hour), End: evening.Add(time.Hour), Comment: "upgrade"},
+		{Start: evening.Add(-time.Hour), End: evening.Add(2 * time.Hour), Comment: "migration"},
+	}
+	w := s.activeWindow(evening)
+	if w == nil || w.Kind != MaintenanceKind || w.Comment != "migration" || !w.Until.Equal(evening.Add(2*time.Hour)) {
+		t.Errorf("unexpected window %+v during maintenance", w)
+	}
+}
+
+func TestHoldNotifications(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+
+	s.holdNotifications([]Notification{
+		{Event: BrokenEvent, Project: "api", Branch: "master"},
+		{Event: BrokenEvent, Project: "web", Branch: "master"},
+	})
+	s.holdNotifications([]Notification{
+		{Event: FixedEvent, Project: "api", Branch: "master"},
+		{Event: StillFailingEvent, Project: "web", Branch: "master"},
+		{Event: FixedEvent, Project: "db", Branch: "master"},
+	})
+
+	held := s.heldNotifications
+	if len(held) != 2 {
+		t.Fatalf("held %+v", held)
+	}
+	if held[0].Project != "web" || held[0].Event != BrokenEvent {
+		t.Errorf("a branch still broken is not held as broken: %+v", held[0])
+	}
+	if held[1].Project != "db" || held[1].Event != FixedEvent {
+		t.Errorf("unexpected held notification %+v", held[1])
+	}
+}
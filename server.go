@@ -1,11 +1,15 @@
 package cistatus
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -20,53 +24,450 @@ type Server struct {
 		Secret    []byte
 	}
 
+	// Addr is the TCP address Run listens on. When empty Run does not
+	// listen and the Server is expected to be mounted in another
+	// http.Server.
+	Addr string
+
+	// FetchTimeout is the deadline applied to each poll of the Fetcher. It
+	// must be shorter than the fetch interval; when zero (or too long)
+	// three quarters of the fetch interval is used.
+	FetchTimeout time.Duration
+
+	// ReadyIntervals is the number of fetch intervals after the last
+	// successful fetch that the server is still reported ready by /readyz.
+	// When zero DefaultReadyIntervals is used.
+	ReadyIntervals int
+
+	// StatePath is the file the latest summary and fetch health are saved
+	// to on every change and restored from by Run. When empty no state is
+	// kept.
+	StatePath string
+
+	// History, if set, records every transition of a job's state and of
+	// the overall color. It is served by /api/history and summarized by
+	// /api/stats.
+	History *HistoryStore
+
+	// FlakyDowngrade makes failures of flaky jobs count as yellow in every
+	// color served while a newer run of the same job, with the same commit,
+	// is pending or running. A job is flaky once its flakiness reaches
+	// FlakyThreshold, DefaultFlakyThreshold when zero.
+	FlakyDowngrade bool
+	FlakyThreshold float64
+
+	// Subscriptions are notified when a branch breaks, is fixed and, every
+	// StillFailingAfter if not zero, while it stays broken. They must be
+	// set before Run is called.
+	Subscriptions     []*Subscription
+	StillFailingAfter time.Duration
+
+	// QuietHours, if set, are when the summary color is Off. Maintenance
+	// windows are scheduled through /api/maintenance. Notifications are
+	// held during both and sent, coalesced per branch, once they end.
+	QuietHours *QuietHours
+
 	*http.ServeMux
-	wsHub *wsHub
+	httpServer *http.Server
+	wsHub      *wsHub
+	sseHub     *sseHub
+	metrics    *serverMetrics
 
 	fetcher       Fetcher
-	latestSummary Summary
+	fetchInterval time.Duration
+	fetchDone     chan struct{}
+	notifiersDone sync.WaitGroup
+
+	mu              sync.RWMutex
+	fetchedProjects []Project
+	pushedProjects  []Project
+	latestSummary   Summary
+	summaryChanged  chan struct{}
+	fetchHealth     FetchHealth
+	restored        bool
+	running         bool
+	acks            []Ack
+	flaky           *flakyDetector
+	branchHealth    map[branchKey]*branchHealth
+	notifyPrimed    bool
+
+	maintenance       []MaintenanceWindow
+	heldNotifications []Notification
+	windowTimer       *time.Timer
+
+	stateMu    sync.Mutex
+	stateSaved time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
+// NewServer creates a Server that fetches the CI status from fetcher every
+// fetchInterval. Nothing is fetched or served until Run is called.
 func NewServer(fetcher Fetcher, fetchInterval time.Duration) *Server {
 	now := time.Now()
 
 	s := &Server{
-		fetcher: fetcher,
+		fetcher:       fetcher,
+		fetchInterval: fetchInterval,
+		fetchDone:     make(chan struct{}),
 		// Initial status summary is "unknown"
 		latestSummary: Summary{
 			Color:       Unknown,
 			LastUpdated: &now,
 		},
+		summaryChanged: make(chan struct{}),
+		fetchHealth: FetchHealth{
+			Condition: FetchPending,
+		},
 		// Default to discarding logs
-		Logger: log.New(ioutil.Discard, "", 0),
-		wsHub:  newWSHub(),
+		Logger:       log.New(ioutil.Discard, "", 0),
+		wsHub:        newWSHub(),
+		sseHub:       newSSEHub(),
+		metrics:      newServerMetrics(),
+		flaky:        newFlakyDetector(),
+		branchHealth: make(map[branchKey]*branchHealth),
+		stop:         make(chan struct{}),
 	}
 
-	// Start WebSocket Hub
-	go s.wsHub.run()
-
 	// Create servemux with routes to http api
 	s.ServeMux = http.NewServeMux()
+	s.ServeMux.HandleFunc("/", s.dashboardHandler)
 	s.ServeMux.HandleFunc("/api", s.allProjects)
 	s.ServeMux.HandleFunc("/api/watch", s.websocketSubscribeHandler)
+	s.ServeMux.HandleFunc("/api/events", s.eventsHandler)
+	s.ServeMux.HandleFunc("/api/statuses", s.pushStatusHandler)
+	s.ServeMux.HandleFunc("/api/projects", s.projectsHandler)
+	s.ServeMux.HandleFunc("/api/projects/", s.projectsHandler)
+	s.ServeMux.HandleFunc("/badge.svg", s.badgeHandler)
+	s.ServeMux.HandleFunc("/badge/", s.badgeHandler)
+	s.ServeMux.HandleFunc("/metrics", s.metricsHandler)
+	s.ServeMux.HandleFunc("/healthz", s.livenessHandler)
+	s.ServeMux.HandleFunc("/readyz", s.readinessHandler)
+	s.ServeMux.HandleFunc("/cc.xml", s.ccTrayHandler)
+	s.ServeMux.HandleFunc("/api/history", s.historyHandler)
+	s.ServeMux.HandleFunc("/api/stats", s.statsHandler)
+	s.ServeMux.HandleFunc("/api/flaky", s.flakyHandler)
+	s.ServeMux.HandleFunc("/api/acks", s.acksHandler)
+	s.ServeMux.HandleFunc("/api/maintenance", s.maintenanceHandler)
+
+	return s
+}
+
+// Run starts the WebSocket hub and the fetch loop and, if Addr is set,
+// serves HTTP requests on Addr. It blocks until ctx is done, Shutdown is
+// called or the listener fails. Run must only be called once and should be
+// followed by a call to Shutdown.
+func (s *Server) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return errors.New("cistatus.Server is already running")
+	}
+	s.running = true
+	if s.Addr != "" {
+		s.httpServer = &http.Server{
+			Addr:    s.Addr,
+			Handler: s,
+		}
+	}
+	httpServer := s.httpServer
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Start WebSocket Hub
+	go s.wsHub.run()
+
+	s.startNotifiers(ctx, &s.notifiersDone)
+
+	if s.StatePath != "" {
+		restored, err := s.loadState()
+		if err != nil {
+			s.Logger.Printf("Error restoring state: %s\n", err)
+		}
+		if restored {
+			s.publish(s.summary())
+		}
+	}
+
+	s.mu.Lock()
+	s.scheduleWindowChange(time.Now())
+	s.mu.Unlock()
 
 	// Start fetching
-	go s.fetchLoop(fetchInterval)
+	go func() {
+		defer close(s.fetchDone)
+		s.fetchLoop(ctx, s.fetchInterval)
+	}()
+
+	if httpServer == nil {
+		<-ctx.Done()
+		return nil
+	}
 
-	return s
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errChan:
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return errors.Wrapf(err, "unable to serve http on %s", s.Addr)
+	}
+}
+
+// Shutdown gracefully stops the server: polling is stopped, in-flight HTTP
+// requests are drained and WebSocket subscribers are sent a close frame. If
+// ctx expires first its error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	s.mu.Lock()
+	httpServer := s.httpServer
+	running := s.running
+	if s.windowTimer != nil {
+		s.windowTimer.Stop()
+	}
+	s.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	// Event streams never become idle so they must be ended before the
+	// http server can drain
+	s.sseHub.shutdown()
+
+	if httpServer != nil {
+		err := httpServer.Shutdown(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to drain http requests")
+		}
+	}
+
+	select {
+	case <-s.fetchDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Notifications being delivered are abandoned once Run returns
+	notifiersDone := make(chan struct{})
+	go func() {
+		s.notifiersDone.Wait()
+		close(notifiersDone)
+	}()
+	select {
+	case <-notifiersDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return s.wsHub.shutdown(ctx)
+}
+
+// publish saves the state and broadcasts the summary to WebSocket and event
+// stream subscribers
+func (s *Server) publish(summary Summary) {
+	s.saveState()
+
+	atomic.AddUint64(&s.metrics.broadcasts, 1)
+	s.sseHub.publish(summary)
+	s.wsHub.publish(summary)
+}
+
+func (s *Server) summary() Summary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.latestSummary
+}
+
+// UpdateBranch merges branch into the named project of the fetched projects
+// and broadcasts the result to subscribers. It is used by webhooks for the
+// CI server the Fetcher polls to update the status between polls; the next
+// poll replaces the update.
+func (s *Server) UpdateBranch(project string, branch Branch) {
+	s.mu.Lock()
+	s.fetchedProjects = mergeBranch(s.fetchedProjects, project, branch)
+	s.rebuildSummary(time.Now())
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	s.Logger.Printf("Updated %s project, %s branch\n", project, branch)
+	s.publish(summary)
+}
+
+// PushBranch merges branch into the named project of the pushed projects
+// and broadcasts the result to subscribers. Pushed projects are kept across
+// polls and merged over the fetched projects, so it is used by sources the
+// Fetcher does not poll.
+func (s *Server) PushBranch(project string, branch Branch) {
+	s.mu.Lock()
+	s.pushedProjects = mergeBranch(s.pushedProjects, project, branch)
+	s.rebuildSummary(time.Now())
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	s.Logger.Printf("Pushed %s project, %s branch\n", project, branch)
+	s.publish(summary)
+}
+
+// RemovePushedBranch removes a branch previously added with PushBranch and
+// broadcasts the result to subscribers.
+func (s *Server) RemovePushedBranch(project, branch string) {
+	s.mu.Lock()
+	s.pushedProjects = removeBranch(s.pushedProjects, project, branch)
+	s.rebuildSummary(time.Now())
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	s.Logger.Printf("Removed %s project, %s branch\n", project, branch)
+	s.publish(summary)
+}
+
+// rebuildSummary recomputes the latest summary from the fetched and pushed
+// projects and reports whether the color changed. During quiet hours and
+// maintenance windows the color is Off or Maintenance and notifications are
+// held. s.mu must be held.
+func (s *Server) rebuildSummary(now time.Time) bool {
+	projects := s.fetchedProjects
+	for _, project := range s.pushedProjects {
+		for _, branch := range project.Branches {
+			projects = mergeBranch(projects, project.Name, branch)
+		}
+	}
+
+	s.flaky.observe(now, projects)
+	projects = s.flaky.annotate(projects)
+	s.applyAcks(now, projects)
+
+	policy := s.colorPolicy()
+	for i := range projects {
+		for j := range projects[i].Branches {
+			projects[i].Branches[j].Color = branchColor(projects[i].Branches[j], policy)
+		}
+	}
+
+	newColor := color(projects, policy)
+	statusColor := newColor
+
+	window := s.activeWindow(now)
+	s.holdNotifications(s.detectTransitions(now, projects))
+	if window != nil {
+		newColor = window.color()
+	} else {
+		s.releaseNotifications()
+	}
+	changed := newColor != s.latestSummary.Color
+
+	s.latestSummary.Projects = projects
+	s.latestSummary.Color = newColor
+	s.latestSummary.Window = window
+	s.latestSummary.StatusColor = ""
+	if window != nil {
+		s.latestSummary.StatusColor = statusColor
+	}
+	s.latestSummary.LastUpdated = &now
+	s.latestSummary.Restored = s.restored
+	s.latestSummary.Culprits = s.annotateBroken(projects)
+
+	if s.History != nil {
+		// Windows do not change the status of the builds, the history and
+		// statistics are of the builds
+		err := s.History.record(now, projects, statusColor)
+		if err != nil {
+			s.Logger.Printf("Error recording history: %s\n", err)
+		}
+	}
+
+	// Wake long-polling requests
+	close(s.summaryChanged)
+	s.summaryChanged = make(chan struct{})
+
+	return changed
 }
 
+// allProjects serves the summary. It supports conditional requests with
+// If-None-Match and, with the wait query parameter, long-polling until the
+// summary no longer matches or the wait expires.
 func (s *Server) allProjects(w http.ResponseWriter, r *http.Request) {
-	latestSummary := s.latestSummary
+	authorized := s.isAuthorized(r)
 
-	if !s.isAuthorized(r) {
-		latestSummary.Projects = []Project{}
+	wait, err := longPollWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	for {
+		s.mu.RLock()
+		latestSummary := s.latestSummary
+		changed := s.summaryChanged
+		s.mu.RUnlock()
+
+		if !authorized {
+			latestSummary.Projects = []Project{}
+			latestSummary.Culprits = nil
+		}
+
+		etag := summaryETag(latestSummary)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if !etagMatches(ifNoneMatch, etag) {
+			writeJSON(w, http.StatusOK, latestSummary)
+			return
+		}
+
+		if wait == 0 {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timeout.C:
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-s.stop:
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeJSON writes v as the JSON response body with the standard server
+// headers
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Server", "https://github.com/tantalic/cistatus")
 	w.Header().Set("X-Server-Version", Version)
-	json.NewEncoder(w).Encode(latestSummary)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
 }
 
 func (s *Server) jwtKey(token *jwt.Token) (interface{}, error) {
@@ -95,13 +496,82 @@ func (s *Server) isAuthorized(r *http.Request) bool {
 		return false
 	}
 
-	token, err := jwt.Parse(headerParts[1], s.jwtKey)
+	// Feed tokens only authorize the feeds
+	scope, ok := s.tokenScope(headerParts[1])
+	return ok && scope == ""
+}
+
+// isAuthorizedFeed is isAuthorized for the read-only feeds, the badges and
+// cc.xml, whose clients often cannot set a bearer token. Besides the
+// Authorization header they accept HTTP basic authentication with the token
+// as the password, as CCTray clients support, and a token with the feed
+// scope in the token query parameter, for images embedded in web pages.
+// Tokens in URLs end up in access logs, browser history and Referer headers
+// so API tokens are never accepted there.
+func (s *Server) isAuthorizedFeed(r *http.Request) bool {
+	if s.isAuthorized(r) {
+		return true
+	}
+
+	if _, password, ok := r.BasicAuth(); ok {
+		_, valid := s.tokenScope(password)
+		return valid
+	}
+
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "bearer ") {
+		scope, valid := s.tokenScope(strings.TrimPrefix(header, "bearer "))
+		return valid && scope == FeedScope
+	}
+
+	tokenString := r.URL.Query().Get("token")
+	if tokenString == "" {
+		return false
+	}
+
+	scope, valid := s.tokenScope(tokenString)
+	return valid && scope == FeedScope
+}
+
+// tokenScope returns the scope claim of a token, empty for API tokens, and
+// whether the token is valid
+func (s *Server) tokenScope(tokenString string) (string, bool) {
+	token, err := jwt.Parse(tokenString, s.jwtKey)
 	if err != nil {
 		s.Logger.Printf("JWT error: %s\n", err)
-		return false
+		return "", false
+	}
+	if !token.Valid {
+		return "", false
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	scope, _ := claims["scope"].(string)
+	return scope, true
+}
+
+// FeedScope is the scope claim of the tokens accepted in the token query
+// parameter of the badges and cc.xml. They authorize nothing else.
+const FeedScope = "feed"
+
+// FeedToken creates a token with the feed scope, signed with the same
+// algorithm and secret as Server.JWT, that expires after ttl. Feed tokens
+// should be short-lived as they are shared in URLs.
+func FeedToken(algorithm string, secret []byte, ttl time.Duration) (string, error) {
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return "", errors.Errorf("unknown jwt algorithm %q", algorithm)
+	}
+
+	claims := jwt.MapClaims{
+		"scope": FeedScope,
+		"exp":   time.Now().Add(ttl).Unix(),
 	}
 
-	return token.Valid
+	token, err := jwt.NewWithClaims(method, claims).SignedString(secret)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to sign token")
+	}
+	return token, nil
 }
 
 func (s *Server) websocketSubscribeHandler(w http.ResponseWriter, r *http.Request) {
@@ -113,52 +583,170 @@ func (s *Server) websocketSubscribeHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	subscriber := newWSSubscriber(conn)
-	s.wsHub.register <- subscriber
+	s.wsHub.subscribe(subscriber)
 }
 
-func (s *Server) fetchLoop(interval time.Duration) {
-	ticker := time.Tick(interval)
-	errCount := 0
-
-	for {
-		s.Logger.Println("Fetching CI server status")
+// fetchLoop fetches the status every interval, and whenever a
+// WatchingFetcher reports a change, until ctx is done
+func (s *Server) fetchLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		projects, err := s.fetcher.FetchStatus()
-		if err != nil {
-			s.Logger.Printf("Error fetching status: %s\n", err)
-			errCount++
-			if errCount >= 10 {
+	var changes <-chan struct{}
+	if watcher, ok := s.fetcher.(WatchingFetcher); ok {
+		changes = watcher.Watch(ctx)
+	}
 
+	triggered := false
+	for {
+		s.fetch(ctx, triggered)
+		triggered = false
+
+		select {
+		case <-ctx.Done():
+			s.Logger.Println("Stopped fetching CI server status")
+			return
+		case <-ticker.C:
+		case _, ok := <-changes:
+			if !ok {
+				// The fetcher stopped watching, only poll from now on
+				changes = nil
+				break
 			}
-			<-ticker
-			continue
+			s.Logger.Println("CI server status changed")
+			triggered = true
 		}
+	}
+}
+
+// fetchTimeout returns the deadline to apply to each poll
+func (s *Server) fetchTimeout() time.Duration {
+	if s.FetchTimeout <= 0 || s.FetchTimeout >= s.fetchInterval {
+		return s.fetchInterval * 3 / 4
+	}
+
+	return s.FetchTimeout
+}
 
-		now := time.Now()
-		s.latestSummary.Projects = projects
-		s.latestSummary.LastUpdated = &now
+// fetch polls the Fetcher once. The summary is broadcast when the color
+// changes, or always when the fetch was triggered by a WatchingFetcher as
+// the change it reported may not affect the color.
+func (s *Server) fetch(ctx context.Context, triggered bool) {
+	s.Logger.Println("Fetching CI server status")
+
+	fetchCtx, cancel := context.WithTimeout(ctx, s.fetchTimeout())
+	defer cancel()
+
+	start := time.Now()
+	projects, err := s.fetcher.FetchStatus(fetchCtx)
+	now := time.Now()
+	s.metrics.fetchDurations.observe(now.Sub(start).Seconds())
+	if err != nil {
+		if ctx.Err() != nil {
+			// The server is shutting down, this is not a failed poll
+			s.Logger.Printf("Fetch cancelled: %s\n", err)
+			return
+		}
 
-		newColor := color(projects)
-		if newColor != s.latestSummary.Color {
-			s.latestSummary.Color = newColor
-			s.wsHub.broadcast <- s.latestSummary
+		timedOut := fetchCtx.Err() == context.DeadlineExceeded
+		if timedOut {
+			s.Logger.Printf("Timed out fetching status after %s: %s\n", s.fetchTimeout(), err)
+		} else {
+			s.Logger.Printf("Error fetching status: %s\n", err)
 		}
 
-		s.Logger.Printf("Fetched %d projects\n", len(projects))
-		<-ticker
+		s.mu.Lock()
+		condition := s.fetchHealth.Condition
+		s.fetchHealth.recordFailure(now, err, timedOut)
+		conditionChanged := s.fetchHealth.Condition != condition
+		s.mu.Unlock()
+
+		s.saveStateIf(conditionChanged)
+		return
+	}
+
+	s.mu.Lock()
+	conditionChanged := s.fetchHealth.Condition != FetchOK
+	projectsChanged := !reflect.DeepEqual(s.fetchedProjects, projects)
+	s.fetchHealth.recordSuccess(now)
+	s.pushedProjects = dropStaleBranches(s.pushedProjects, s.fetchedProjects, projects)
+	s.fetchedProjects = projects
+	wasRestored := s.restored
+	s.restored = false
+	changed := s.rebuildSummary(now)
+	s.notifyPrimed = true
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	if changed || triggered || wasRestored {
+		s.publish(summary)
+	} else {
+		s.saveStateIf(projectsChanged || conditionChanged)
 	}
+
+	s.Logger.Printf("Fetched %d projects\n", len(projects))
+}
+
+// colorPolicy adjusts how statuses count towards a color
+type colorPolicy struct {
+	// flakyThreshold, when not zero, makes a failure of a job with a
+	// flakiness of at least flakyThreshold count as yellow while a newer
+	// run of the same job is pending or running
+	flakyThreshold float64
 }
 
-func color(projects []Project) Color {
+// colorPolicy returns the policy of the summary color, which every other
+// color served should follow
+func (s *Server) colorPolicy() colorPolicy {
+	if s.FlakyDowngrade {
+		return colorPolicy{flakyThreshold: s.flakyThreshold()}
+	}
+	return colorPolicy{}
+}
+
+// flaky reports whether the policy tolerates the failures of the job of
+// status while it is retried
+func (p colorPolicy) flaky(status Status) bool {
+	return p.flakyThreshold > 0 && status.Flakiness >= p.flakyThreshold
+}
+
+// retried reports whether failed is a failure of a flaky job that the
+// policy tolerates because a newer run of the job is on branch
+func (p colorPolicy) retried(branch Branch, failed Status) bool {
+	if !p.flaky(failed) {
+		return false
+	}
+
+	for _, status := range branch.Statuses {
+		if status.Name == failed.Name && status.Created.After(failed.Created) &&
+			(status.Status == "pending" || status.Status == "running") {
+			return true
+		}
+	}
+	return false
+}
+
+func color(projects []Project, policy colorPolicy) Color {
 	color := Green
+	acknowledged := false
+	unknown := false
 
 	for _, project := range projects {
 		for _, branch := range project.Branches {
 			for _, status := range branch.Statuses {
 
-				// If any status is failed return red immediately
-				if status.Status == "failed" {
-					return Red
+				// If any status is failing and neither tolerated as
+				// a flaky job being retried nor acknowledged return red
+				// immediately
+				if status.failing() {
+					switch {
+					case status.Retry && policy.flaky(status), status.Status == "failed" && policy.retried(branch, status):
+						color = Yellow
+					case status.Ack == nil:
+						return Red
+					default:
+						acknowledged = true
+					}
 				}
 
 				// If any status is pending or running return yellow
@@ -166,9 +754,32 @@ func color(projects []Project) Color {
 					color = Yellow
 				}
 
+				if status.Status == UnknownStatus {
+					unknown = true
+				}
+
 			}
 		}
 	}
 
+	// Acknowledged failures still outrank running builds, and so do
+	// statuses that cannot be known as they may be failures
+	if acknowledged {
+		return Acknowledged
+	}
+	if unknown {
+		return Unknown
+	}
+
 	return color
 }
+
+// projectColor computes the color of a single project
+func projectColor(project Project, policy colorPolicy) Color {
+	return color([]Project{project}, policy)
+}
+
+// branchColor computes the color of a single branch
+func branchColor(branch Branch, policy colorPolicy) Color {
+	return color([]Project{{Branches: []Branch{branch}}}, policy)
+}
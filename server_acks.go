@@ -0,0 +1,277 @@
+package cistatus
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAckTTL is how long an acknowledgement lasts when no TTL is given
+const DefaultAckTTL = 24 * time.Hour
+
+// Ack acknowledges the failure of a job, or of every job of a branch when
+// Job is empty. Acknowledged failures make the color Acknowledged instead of
+// Red. An ack is cleared when it expires, when the commit of the branch
+// changes or when the acknowledged jobs stop failing.
+type Ack struct {
+	Project string    `json:"project"`
+	Branch  string    `json:"branch"`
+	Job     string    `json:"job,omitempty"`
+	Commit  string    `json:"commit"`
+	Comment string    `json:"comment"`
+	Author  string    `json:"author,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func (a Ack) covers(project, branch, job string) bool {
+	return a.Project == project && a.Branch == branch && (a.Job == "" || a.Job == job)
+}
+
+// ackRequest is the payload accepted by POST /api/acks
+type ackRequest struct {
+	Project string `json:"project"`
+	Branch  string `json:"branch"`
+	Job     string `json:"job"`
+	Comment string `json:"comment"`
+	Author  string `json:"author"`
+	// TTL is a duration (such as "2h") after which the ack expires,
+	// DefaultAckTTL when empty
+	TTL string `json:"ttl"`
+}
+
+func (a ackRequest) validate() error {
+	if a.Project == "" || a.Branch == "" {
+		return errors.New("project and branch are required")
+	}
+
+	if a.Comment == "" {
+		return errors.New("comment is required")
+	}
+
+	return nil
+}
+
+// acksResource is the response body of GET /api/acks
+type acksResource struct {
+	Acks []Ack `json:"acks"`
+}
+
+// acksHandler lists (GET), adds (POST) and clears (DELETE) acks. Requests
+// must be authorized in the same way as /api. DELETE clears the acks
+// matching the project, branch and, optionally, job query parameters.
+func (s *Server) acksHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		s.mu.RLock()
+		acks := append([]Ack{}, s.acks...)
+		s.mu.RUnlock()
+
+		writeJSON(w, http.StatusOK, acksResource{acks})
+	case "POST":
+		s.postAck(w, r)
+	case "DELETE":
+		s.deleteAck(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) postAck(w http.ResponseWriter, r *http.Request) {
+	var a ackRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushPayloadSize)).Decode(&a)
+	if err != nil {
+		http.Error(w, "unable to parse ack", http.StatusBadRequest)
+		return
+	}
+
+	err = a.validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ttl := DefaultAckTTL
+	if a.TTL != "" {
+		ttl, err = time.ParseDuration(a.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	ack := Ack{
+		Project: a.Project,
+		Branch:  a.Branch,
+		Job:     a.Job,
+		Comment: a.Comment,
+		Author:  a.Author,
+		Created: now,
+		Expires: now.Add(ttl),
+	}
+
+	s.mu.Lock()
+	branch, ok := projectBranch(s.latestSummary.Projects, a.Project, a.Branch)
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "branch not found", http.StatusNotFound)
+		return
+	}
+	if !ackable(branch, ack) {
+		s.mu.Unlock()
+		http.Error(w, "nothing is failing", http.StatusConflict)
+		return
+	}
+
+	ack.Commit = branch.Commit
+	s.acks = append(removeAcks(s.acks, a.Project, a.Branch, a.Job), ack)
+	s.rebuildSummary(now)
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	time.AfterFunc(ttl, func() {
+		s.expireAcks()
+	})
+
+	s.Logger.Printf("Acknowledged %s project, %s branch: %s\n", a.Project, a.Branch, a.Comment)
+	s.publish(summary)
+
+	writeJSON(w, http.StatusCreated, ack)
+}
+
+func (s *Server) deleteAck(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	project, branch, job := query.Get("project"), query.Get("branch"), query.Get("job")
+	if project == "" || branch == "" {
+		http.Error(w, "project and branch are required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	acks := removeAcks(s.acks, project, branch, job)
+	if len(acks) == len(s.acks) {
+		s.mu.Unlock()
+		http.Error(w, "ack not found", http.StatusNotFound)
+		return
+	}
+	s.acks = acks
+	s.rebuildSummary(time.Now())
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	s.Logger.Printf("Cleared acks of %s project, %s branch\n", project, branch)
+	s.publish(summary)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// expireAcks removes the expired acks
+func (s *Server) expireAcks() {
+	now := time.Now()
+
+	s.mu.Lock()
+	acks := s.acks[:0:0]
+	for _, ack := range s.acks {
+		if now.Before(ack.Expires) {
+			acks = append(acks, ack)
+		}
+	}
+	if len(acks) == len(s.acks) {
+		s.mu.Unlock()
+		return
+	}
+	s.acks = acks
+	s.rebuildSummary(now)
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	s.Logger.Println("Acks expired")
+	s.publish(summary)
+}
+
+// scheduleAckExpiries schedules the expiry of restored acks
+func (s *Server) scheduleAckExpiries(acks []Ack) {
+	for _, ack := range acks {
+		time.AfterFunc(time.Until(ack.Expires), func() {
+			s.expireAcks()
+		})
+	}
+}
+
+// applyAcks drops the acks that expired or no longer match a failure and
+// marks the acknowledged failed statuses of projects, which must not be
+// shared. s.mu must be held.
+func (s *Server) applyAcks(now time.Time, projects []Project) {
+	acks := s.acks[:0:0]
+	for _, ack := range s.acks {
+		branch, ok := projectBranch(projects, ack.Project, ack.Branch)
+		if ok && now.Before(ack.Expires) && branch.Commit == ack.Commit && ackable(branch, ack) {
+			acks = append(acks, ack)
+		} else {
+			s.Logger.Printf("Cleared ack of %s project, %s branch\n", ack.Project, ack.Branch)
+		}
+	}
+	s.acks = acks
+
+	for i := range projects {
+		for j := range projects[i].Branches {
+			branch := &projects[i].Branches[j]
+			for k := range branch.Statuses {
+				status := &branch.Statuses[k]
+				status.Ack = nil
+				if !status.failing() {
+					continue
+				}
+
+				for a := range acks {
+					if acks[a].covers(projects[i].Name, branch.Name, status.Name) {
+						ack := acks[a]
+						status.Ack = &ack
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// ackable reports whether the ack covers a failing status of branch
+func ackable(branch Branch, ack Ack) bool {
+	for _, status := range branch.Statuses {
+		if status.failing() && (ack.Job == "" || ack.Job == status.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeAcks returns acks without the ones of the project and branch, only
+// the ones of job when it is not empty
+func removeAcks(acks []Ack, project, branch, job string) []Ack {
+	kept := acks[:0:0]
+	for _, ack := range acks {
+		if ack.Project == project && ack.Branch == branch && (job == "" || ack.Job == job) {
+			continue
+		}
+		kept = append(kept, ack)
+	}
+	return kept
+}
+
+// projectBranch returns a branch of a project
+func projectBranch(projects []Project, project, branch string) (Branch, bool) {
+	p, ok := findProject(projects, project)
+	if !ok {
+		return Branch{}, false
+	}
+	return findBranch(p, branch)
+}
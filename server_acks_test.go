@@ -0,0 +1,132 @@
+package cistatus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAckServer returns a server whose api/master branch fails at commit
+func newAckServer(commit string) *Server {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	go s.wsHub.run()
+	setFetched(s, commit)
+	return s
+}
+
+// setFetched replaces the fetched projects with a failing api/master branch
+// at commit
+func setFetched(s *Server, commit string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetchedProjects = []Project{{
+		Name: "api",
+		Branches: []Branch{{
+			Name:     "master",
+			Commit:   commit,
+			Statuses: []Status{{Name: "build", Status: "success"}, {Name: "test", Status: "failed"}},
+		}},
+	}}
+	s.rebuildSummary(time.Now())
+}
+
+func ackRequestTo(s *Server, method, url, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.acksHandler(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+	return w
+}
+
+func TestAck(t *testing.T) {
+	s := newAckServer("abc")
+	if color := s.summary().Color; color != Red {
+		t.Fatalf("color %s, want %s", color, Red)
+	}
+
+	w := ackRequestTo(s, "POST", "/api/acks", `{"project": "api", "branch": "master", "job": "test", "comment": "flaky runner"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if color := s.summary().Color; color != Acknowledged {
+		t.Errorf("color %s after the ack, want %s", color, Acknowledged)
+	}
+
+	status, _, _ := findStatus(s.summary().Projects, "api", "master", "test")
+	if status.Ack == nil || status.Ack.Commit != "abc" || status.Ack.Comment != "flaky runner" {
+		t.Errorf("unexpected ack %+v", status.Ack)
+	}
+
+	w = ackRequestTo(s, "DELETE", "/api/acks?project=api&branch=master", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if color := s.summary().Color; color != Red {
+		t.Errorf("color %s after clearing the ack, want %s", color, Red)
+	}
+
+	w = ackRequestTo(s, "DELETE", "/api/acks?project=api&branch=master", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d clearing a missing ack, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAckClearedByNewCommit(t *testing.T) {
+	s := newAckServer("abc")
+
+	w := ackRequestTo(s, "POST", "/api/acks", `{"project": "api", "branch": "master", "comment": "known"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	setFetched(s, "def")
+	if color := s.summary().Color; color != Red {
+		t.Errorf("color %s after a new commit, want %s", color, Red)
+	}
+	if len(s.acks) != 0 {
+		t.Errorf("ack kept after a new commit: %+v", s.acks)
+	}
+}
+
+func TestAckRejected(t *testing.T) {
+	s := newAckServer("abc")
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"project": "api", "branch": "master"}`, http.StatusBadRequest},
+		{`{"project": "api", "branch": "master", "comment": "c", "ttl": "-1h"}`, http.StatusBadRequest},
+		{`{"project": "api", "branch": "develop", "comment": "c"}`, http.StatusNotFound},
+		{`{"project": "api", "branch": "master", "job": "build", "comment": "c"}`, http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		w := ackRequestTo(s, "POST", "/api/acks", test.body)
+		if w.Code != test.code {
+			t.Errorf("%s: status %d, want %d", test.body, w.Code, test.code)
+		}
+	}
+
+	if color := s.summary().Color; color != Red {
+		t.Errorf("color %s, want %s", color, Red)
+	}
+}
+
+func TestExpireAcks(t *testing.T) {
+	s := newAckServer("abc")
+
+	now := time.Now()
+	s.mu.Lock()
+	s.acks = []Ack{{Project: "api", Branch: "master", Commit: "abc", Created: now.Add(-time.Hour), Expires: now.Add(-time.Minute)}}
+	s.mu.Unlock()
+
+	s.expireAcks()
+	if len(s.acks) != 0 {
+		t.Errorf("expired ack kept: %+v", s.acks)
+	}
+	if color := s.summary().Color; color != Red {
+		t.Errorf("color %s, want %s", color, Red)
+	}
+}
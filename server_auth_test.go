@@ -0,0 +1,90 @@
+package cistatus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestFeedAuthorization(t *testing.T) {
+	secret := []byte("secret")
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.JWT.Algorithm = "HS512"
+	s.JWT.Secret = secret
+
+	apiToken, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedToken, err := FeedToken("HS512", secret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredToken, err := FeedToken("HS512", secret, -time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		basic  string
+		api    bool
+		feed   bool
+	}{
+		{name: "no token"},
+		{name: "API token in header", header: "bearer " + apiToken, api: true, feed: true},
+		{name: "feed token in header", header: "bearer " + feedToken, feed: true},
+		{name: "API token in query", url: "?token=" + apiToken},
+		{name: "feed token in query", url: "?token=" + feedToken, feed: true},
+		{name: "expired feed token in query", url: "?token=" + expiredToken},
+		{name: "API token as basic auth password", basic: apiToken, feed: true},
+		{name: "feed token as basic auth password", basic: feedToken, feed: true},
+		{name: "invalid basic auth password", basic: "secret"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/cc.xml"+test.url, nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		if test.basic != "" {
+			r.SetBasicAuth("cctray", test.basic)
+		}
+
+		if got := s.isAuthorized(r); got != test.api {
+			t.Errorf("%s: isAuthorized = %t, want %t", test.name, got, test.api)
+		}
+		if got := s.isAuthorizedFeed(r); got != test.feed {
+			t.Errorf("%s: isAuthorizedFeed = %t, want %t", test.name, got, test.feed)
+		}
+	}
+}
+
+func TestBadgeFeedToken(t *testing.T) {
+	secret := []byte("secret")
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.JWT.Algorithm = "HS512"
+	s.JWT.Secret = secret
+
+	feedToken, err := FeedToken("HS512", secret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for url, want := range map[string]int{
+		"/badge/api.svg":                    http.StatusUnauthorized,
+		"/badge/api.svg?token=" + feedToken: http.StatusNotFound,
+		"/badge/api.svg?token=invalid":      http.StatusUnauthorized,
+	} {
+		w := httptest.NewRecorder()
+		s.badgeHandler(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", url, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package cistatus
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultBadgeLabel = "build"
+
+	badgeStyleFlat        = "flat"
+	badgeStyleForTheBadge = "for-the-badge"
+)
+
+var (
+	badgeMessages = map[Color]string{
+		Green:        "passing",
+		Yellow:       "running",
+		Red:          "failing",
+		Acknowledged: "acknowledged",
+		Unknown:      "unknown",
+		Off:          "off",
+		Maintenance:  "maintenance",
+	}
+
+	badgeFills = map[Color]string{
+		Green:        "#4c1",
+		Yellow:       "#dfb317",
+		Red:          "#e05d44",
+		Acknowledged: "#fe7d37",
+		Unknown:      "#9f9f9f",
+		Off:          "#555",
+		Maintenance:  "#007ec6",
+	}
+
+	badgeTemplates = map[string]*template.Template{
+		badgeStyleFlat:        template.Must(template.New(badgeStyleFlat).Parse(flatBadgeTemplate)),
+		badgeStyleForTheBadge: template.Must(template.New(badgeStyleForTheBadge).Parse(forTheBadgeTemplate)),
+	}
+)
+
+// badge holds the values rendered into a badge template
+type badge struct {
+	Label        string
+	Message      string
+	Fill         string
+	LabelWidth   int
+	MessageWidth int
+}
+
+func (b badge) Width() int {
+	return b.LabelWidth + b.MessageWidth
+}
+
+func (b badge) LabelX() int {
+	return b.LabelWidth / 2
+}
+
+func (b badge) MessageX() int {
+	return b.LabelWidth + b.MessageWidth/2
+}
+
+// newBadge creates a badge sized for style. Text widths are approximated
+// from the character count as the fonts are not available to measure.
+func newBadge(style, label, message string, fill string) badge {
+	b := badge{
+		Label:   label,
+		Message: message,
+		Fill:    fill,
+	}
+
+	if style == badgeStyleForTheBadge {
+		b.Label = strings.ToUpper(label)
+		b.Message = strings.ToUpper(message)
+		b.LabelWidth = len(b.Label)*9 + 24
+		b.MessageWidth = len(b.Message)*9 + 24
+		return b
+	}
+
+	b.LabelWidth = len(b.Label)*7 + 10
+	b.MessageWidth = len(b.Message)*7 + 10
+	return b
+}
+
+// badgeHandler renders SVG status badges:
+//
+//	/badge.svg                       overall status
+//	/badge/{project}.svg             status of every branch of a project
+//	/badge/{project}/{branch}.svg    status of a single branch
+//
+// The label, style (flat or for-the-badge) and job query parameters
+// customize the badge. During quiet hours and maintenance windows every
+// badge shows Off or Maintenance, as the summary does. Badges are served
+// with an ETag and must be revalidated, so caches such as GitHub's image
+// proxy never show a stale status. Project and branch badges require authorization, which
+// may be given as a feed token (see FeedToken) in the token query parameter
+// as images cannot set headers.
+func (s *Server) badgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	style := query.Get("style")
+	if style == "" {
+		style = badgeStyleFlat
+	}
+
+	tmpl, ok := badgeTemplates[style]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown badge style %q", style), http.StatusBadRequest)
+		return
+	}
+
+	label := query.Get("label")
+	if label == "" {
+		label = defaultBadgeLabel
+	}
+
+	authorized := s.isAuthorizedFeed(r)
+	summary := s.summary()
+	filter := resourceFilter{
+		jobs: queryValues(query, "job"),
+	}
+
+	code := http.StatusOK
+	var c Color
+
+	switch {
+	case r.URL.Path == "/badge.svg":
+		c = summary.Color
+		if authorized && filter.filtersStatuses() && summary.Color != Unknown {
+			c = filteredColor(filter.projects(summary.Projects), s.colorPolicy())
+		}
+
+	case !strings.HasPrefix(r.URL.Path, "/badge/") || !strings.HasSuffix(r.URL.Path, ".svg"):
+		http.NotFound(w, r)
+		return
+
+	case !authorized:
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+
+	default:
+		path := strings.TrimSuffix(strings.TrimPrefix(r.URL.EscapedPath(), "/badge/"), ".svg")
+		projectName, branchName, ok := splitProjectPath(path)
+		if !ok {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+
+		project, ok := findProject(summary.Projects, projectName)
+		if ok && branchName != "" {
+			var branch Branch
+			branch, ok = findBranch(project, branchName)
+			project.Branches = []Branch{branch}
+		}
+
+		if !ok {
+			code = http.StatusNotFound
+			c = Unknown
+			break
+		}
+
+		c = filteredColor(filter.projects([]Project{project}), s.colorPolicy())
+	}
+
+	if code == http.StatusOK && summary.Window != nil {
+		c = summary.Window.color()
+	}
+
+	message := badgeMessages[c]
+	if code == http.StatusNotFound {
+		message = "not found"
+	}
+
+	var b bytes.Buffer
+	err := tmpl.Execute(&b, newBadge(style, label, message, badgeFills[c]))
+	if err != nil {
+		http.Error(w, "unable to render badge", http.StatusInternalServerError)
+		return
+	}
+
+	cacheControl := "public"
+	if s.JWT.Secret != nil && s.JWT.Algorithm != "" {
+		cacheControl = "private"
+	}
+
+	etag := contentETag(b.Bytes())
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", cacheControl+", no-cache")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Server", "https://github.com/tantalic/cistatus")
+	w.Header().Set("X-Server-Version", Version)
+
+	if code == http.StatusOK && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(code)
+	w.Write(b.Bytes())
+}
+
+// filteredColor is the color of projects that have been filtered, which is
+// unknown when the filter matched nothing
+func filteredColor(projects []Project, policy colorPolicy) Color {
+	if len(projects) == 0 {
+		return Unknown
+	}
+
+	return color(projects, policy)
+}
+
+const flatBadgeTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="{{ .Width }}" height="20" role="img" aria-label="{{ .Label }}: {{ .Message }}">
+	<title>{{ .Label }}: {{ .Message }}</title>
+	<linearGradient id="s" x2="0" y2="100%">
+		<stop offset="0" stop-color="#bbb" stop-opacity=".1"/>
+		<stop offset="1" stop-opacity=".1"/>
+	</linearGradient>
+	<clipPath id="r">
+		<rect width="{{ .Width }}" height="20" rx="3" fill="#fff"/>
+	</clipPath>
+	<g clip-path="url(#r)">
+		<rect width="{{ .LabelWidth }}" height="20" fill="#555"/>
+		<rect x="{{ .LabelWidth }}" width="{{ .MessageWidth }}" height="20" fill="{{ .Fill }}"/>
+		<rect width="{{ .Width }}" height="20" fill="url(#s)"/>
+	</g>
+	<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+		<text x="{{ .LabelX }}" y="15" fill="#010101" fill-opacity=".3">{{ .Label }}</text>
+		<text x="{{ .LabelX }}" y="14">{{ .Label }}</text>
+		<text x="{{ .MessageX }}" y="15" fill="#010101" fill-opacity=".3">{{ .Message }}</text>
+		<text x="{{ .MessageX }}" y="14">{{ .Message }}</text>
+	</g>
+</svg>
+`
+
+const forTheBadgeTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="{{ .Width }}" height="28" role="img" aria-label="{{ .Label }}: {{ .Message }}">
+	<title>{{ .Label }}: {{ .Message }}</title>
+	<g shape-rendering="crispEdges">
+		<rect width="{{ .LabelWidth }}" height="28" fill="#555"/>
+		<rect x="{{ .LabelWidth }}" width="{{ .MessageWidth }}" height="28" fill="{{ .Fill }}"/>
+	</g>
+	<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="10" font-weight="bold" letter-spacing="1.25">
+		<text x="{{ .LabelX }}" y="18">{{ .Label }}</text>
+		<text x="{{ .MessageX }}" y="18">{{ .Message }}</text>
+	</g>
+</svg>
+`
@@ -0,0 +1,71 @@
+package cistatus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBadgesShowWindows(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	now := time.Now()
+	s.mu.Lock()
+	s.fetchedProjects = []Project{
+		{Name: "api", Branches: []Branch{{Name: "master", Statuses: []Status{{Name: "test", Status: "failed"}}}}},
+	}
+	s.maintenance = []MaintenanceWindow{{ID: 1, Start: now.Add(-time.Minute), End: now.Add(time.Hour)}}
+	s.rebuildSummary(now)
+	s.mu.Unlock()
+
+	for _, url := range []string{"/badge.svg", "/badge.svg?job=test", "/badge/api.svg", "/badge/api/master.svg"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", url, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), badgeMessages[Maintenance]) {
+			t.Errorf("%s: badge does not show maintenance: %s", url, w.Body)
+		}
+	}
+}
+
+func TestBadgeETag(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.mu.Lock()
+	s.fetchedProjects = []Project{
+		{Name: "api", Branches: []Branch{{Name: "master", Statuses: []Status{{Name: "test", Status: "success"}}}}},
+	}
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/badge/api.svg", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("badge served without an ETag")
+	}
+	if cacheControl := w.Header().Get("Cache-Control"); !strings.Contains(cacheControl, "no-cache") {
+		t.Errorf("badge may be cached without revalidation: %q", cacheControl)
+	}
+
+	r := httptest.NewRequest("GET", "/badge/api.svg", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("unchanged badge: status %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	s.mu.Lock()
+	s.fetchedProjects[0].Branches[0].Statuses[0].Status = "failed"
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("changed badge: status %d, ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+}
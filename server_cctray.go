@@ -0,0 +1,134 @@
+package cistatus
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ccTrayProjects is the root element of the cctray XML format
+type ccTrayProjects struct {
+	XMLName  xml.Name        `xml:"Projects"`
+	Projects []ccTrayProject `xml:"Project"`
+}
+
+// ccTrayProject is a single project in the cctray XML format. Each branch of
+// a cistatus project is reported as a separate cctray project.
+type ccTrayProject struct {
+	Name            string `xml:"name,attr"`
+	Activity        string `xml:"activity,attr"`
+	LastBuildStatus string `xml:"lastBuildStatus,attr"`
+	LastBuildLabel  string `xml:"lastBuildLabel,attr"`
+	LastBuildTime   string `xml:"lastBuildTime,attr"`
+	WebURL          string `xml:"webUrl,attr"`
+}
+
+// ccTrayHandler serves the summary in the cctray (cc.xml) format understood
+// by CCMenu, BuildNotify, CatLight and similar monitors. The resource filter
+// query parameters are supported and unauthorized requests receive no
+// projects, as with /api. As most monitors cannot send a bearer token the
+// token may be given as the password of HTTP basic authentication.
+func (s *Server) ccTrayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	summary := s.summary()
+
+	projects := []Project{}
+	if s.isAuthorizedFeed(r) {
+		projects = newResourceFilter(r.URL.Query()).projects(summary.Projects)
+	}
+
+	policy := s.colorPolicy()
+	feed := ccTrayProjects{
+		Projects: make([]ccTrayProject, 0),
+	}
+	for _, project := range projects {
+		for _, branch := range project.Branches {
+			feed.Projects = append(feed.Projects, newCCTrayProject(r, summary, project, branch, policy))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Server", "https://github.com/tantalic/cistatus")
+	w.Header().Set("X-Server-Version", Version)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(feed)
+}
+
+// newCCTrayProject reports the branch with the status of its color, so
+// acknowledged failures and downgraded flaky jobs are reported as they are on
+// the dashboard. cctray has no acknowledged status; acknowledged failures are
+// reported as Unknown so monitors stop alerting, as the dashboard does.
+func newCCTrayProject(r *http.Request, summary Summary, project Project, branch Branch, policy colorPolicy) ccTrayProject {
+	p := ccTrayProject{
+		Name:            project.Name + "/" + branch.Name,
+		Activity:        "Sleeping",
+		LastBuildStatus: "Unknown",
+		LastBuildLabel:  branch.Commit,
+		WebURL:          ccTrayWebURL(r, project, branch),
+	}
+
+	if len(p.LastBuildLabel) > 8 {
+		p.LastBuildLabel = p.LastBuildLabel[:8]
+	}
+
+	finished := false
+	var lastBuildTime time.Time
+	for _, status := range branch.Statuses {
+		switch status.Status {
+		case "pending", "running":
+			p.Activity = "Building"
+		case "failed", "success":
+			finished = true
+		}
+
+		if status.Created.After(lastBuildTime) {
+			lastBuildTime = status.Created
+		}
+	}
+
+	switch branchColor(branch, policy) {
+	case Red:
+		p.LastBuildStatus = "Failure"
+	case Green:
+		p.LastBuildStatus = "Success"
+	case Yellow:
+		// Building, or a downgraded flaky failure: the last build is only
+		// known once a job has finished
+		if finished {
+			p.LastBuildStatus = "Success"
+		}
+	}
+
+	if lastBuildTime.IsZero() && summary.LastUpdated != nil {
+		lastBuildTime = *summary.LastUpdated
+	}
+	p.LastBuildTime = lastBuildTime.Format(time.RFC3339)
+
+	return p
+}
+
+// ccTrayWebURL links to the branch on the CI server when the project URL is
+// known and to the dashboard otherwise
+func ccTrayWebURL(r *http.Request, project Project, branch Branch) string {
+	if project.URL != "" {
+		return strings.TrimSuffix(project.URL, "/") + "/tree/" + branch.Name
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	query := url.Values{}
+	query.Set("project", project.Name)
+	query.Set("branch", branch.Name)
+
+	return scheme + "://" + r.Host + "/?" + query.Encode()
+}
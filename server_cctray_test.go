@@ -0,0 +1,47 @@
+package cistatus
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCCTrayFollowsBranchColor(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	now := time.Now()
+	s.mu.Lock()
+	s.fetchedProjects = []Project{{Name: "api", Branches: []Branch{
+		{Name: "master", Commit: "abc", Statuses: []Status{{Name: "test", Status: "failed"}}},
+		{Name: "develop", Commit: "def", Statuses: []Status{{Name: "test", Status: "failed"}}},
+		{Name: "feature", Commit: "123", Statuses: []Status{{Name: "test", Status: "success"}, {Name: "deploy", Status: "running"}}},
+		{Name: "fix", Commit: "456", Statuses: []Status{{Name: "test", Status: "pending"}}},
+	}}}
+	s.acks = []Ack{{Project: "api", Branch: "develop", Commit: "def", Created: now, Expires: now.Add(time.Hour)}}
+	s.rebuildSummary(now)
+	s.mu.Unlock()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/cc.xml", nil))
+
+	var feed ccTrayProjects
+	err := xml.Unmarshal(w.Body.Bytes(), &feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][2]string{
+		"api/master":  {"Failure", "Sleeping"},
+		"api/develop": {"Unknown", "Sleeping"},
+		"api/feature": {"Success", "Building"},
+		"api/fix":     {"Unknown", "Building"},
+	}
+	if len(feed.Projects) != len(want) {
+		t.Fatalf("unexpected projects %+v", feed.Projects)
+	}
+	for _, p := range feed.Projects {
+		if got := [2]string{p.LastBuildStatus, p.Activity}; got != want[p.Name] {
+			t.Errorf("%s: got %v, want %v", p.Name, got, want[p.Name])
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package cistatus
+
+import (
+	"net/http"
+)
+
+// dashboardHandler serves the built-in live dashboard. The page loads the
+// summary from /api and then follows /api/watch for updates. It is
+// configured with query parameters:
+//
+//	project  only show the named projects (repeatable or comma separated)
+//	branch   only show the named branches (repeatable or comma separated)
+//	kiosk    dark, non-interactive layout that fits every tile on screen
+//	theme    "dark" or "light"
+//	token    JWT sent to /api when authorization is configured, which is
+//	         best given in the fragment (/#token=...) so that it is not sent
+//	         to the server in the URL or in Referer headers
+func (s *Server) dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Server", "https://github.com/tantalic/cistatus")
+	w.Header().Set("X-Server-Version", Version)
+	w.Write([]byte(dashboardHTML))
+}
+
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>CI Status</title>
+<style>
+	:root {
+		--background: #f4f5f7;
+		--text: #172b4d;
+		--muted: #5e6c84;
+		--tile-text: #fff;
+		--green: #2e9e44;
+		--yellow: #d9a300;
+		--red: #d93a2b;
+		--orange: #e8710a;
+		--question: #8993a4;
+		--black: #42526e;
+		--white: #c1c7d0;
+	}
+	body.dark {
+		--background: #111;
+		--text: #eee;
+		--muted: #999;
+		--green: #1f7a33;
+		--yellow: #a87e00;
+		--red: #b02a1e;
+		--orange: #b35607;
+		--question: #4a5160;
+		--black: #000;
+		--white: #333;
+	}
+	* { box-sizing: border-box; }
+	html, body { margin: 0; height: 100%; }
+	body {
+		background: var(--background);
+		color: var(--text);
+		font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif;
+	}
+	header {
+		display: flex;
+		align-items: baseline;
+		justify-content: space-between;
+		padding: 12px 16px;
+	}
+	header h1 { margin: 0; font-size: 20px; }
+	header .meta { color: var(--muted); font-size: 13px; }
+	#overall { display: inline-block; width: 12px; height: 12px; border-radius: 50%; margin-right: 8px; }
+	#tiles {
+		display: grid;
+		grid-template-columns: repeat(auto-fill, minmax(240px, 1fr));
+		grid-gap: 12px;
+		padding: 0 16px 16px;
+	}
+	.tile {
+		display: block;
+		color: var(--tile-text);
+		text-decoration: none;
+		border-radius: 6px;
+		padding: 12px 14px;
+		overflow: hidden;
+	}
+	.tile h2 { margin: 0; font-size: 18px; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+	.tile h3 { margin: 2px 0 8px; font-size: 14px; font-weight: normal; opacity: .9; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+	.tile ul { margin: 0; padding: 0; list-style: none; font-size: 13px; }
+	.tile li { white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+	.tile .elapsed { font-size: 12px; opacity: .85; margin-top: 6px; }
+	.tile .culprit { font-size: 13px; font-weight: bold; margin-top: 6px; }
+	.green { background: var(--green); }
+	.yellow { background: var(--yellow); }
+	.red { background: var(--red); }
+	.orange { background: var(--orange); }
+	.question { background: var(--question); }
+	.black { background: var(--black); }
+	.white { background: var(--white); }
+	#empty { padding: 16px; color: var(--muted); }
+
+	body.kiosk { overflow: hidden; cursor: none; }
+	body.kiosk * { pointer-events: none; }
+	body.kiosk #tiles { height: calc(100% - 50px); grid-auto-rows: 1fr; }
+	body.kiosk .tile h2 { font-size: 2.4vmin; }
+	body.kiosk .tile h3 { font-size: 1.8vmin; }
+	body.kiosk .tile ul, body.kiosk .tile .elapsed, body.kiosk .tile .culprit { font-size: 1.5vmin; }
+</style>
+</head>
+<body>
+<header>
+	<h1><span id="overall" class="question"></span>CI Status</h1>
+	<span class="meta" id="updated"></span>
+</header>
+<div id="tiles"></div>
+<div id="empty" hidden>No matching projects</div>
+<script>
+(function () {
+	"use strict";
+
+	var params = new URLSearchParams(window.location.search);
+	var kiosk = params.has("kiosk") && params.get("kiosk") !== "false";
+	var dark = kiosk || params.get("theme") === "dark";
+	var token = new URLSearchParams(window.location.hash.substring(1)).get("token") || params.get("token");
+	var projectFilter = listParam("project");
+	var branchFilter = listParam("branch");
+	var summary = null;
+
+	if (kiosk) { document.body.classList.add("kiosk"); }
+	if (dark) { document.body.classList.add("dark"); }
+
+	function listParam(name) {
+		var values = [];
+		params.getAll(name).forEach(function (value) {
+			value.split(",").forEach(function (v) {
+				v = v.trim();
+				if (v) { values.push(v); }
+			});
+		});
+		return values.length ? values : null;
+	}
+
+	// branchColor is the color the server computed for the branch, so that
+	// the tiles follow the same policy as the summary color
+	function branchColor(branch) {
+		return branch.color || "question";
+	}
+
+	function elapsed(date) {
+		var seconds = Math.max(0, Math.floor((Date.now() - date.getTime()) / 1000));
+		if (seconds < 60) { return seconds + "s"; }
+		if (seconds < 3600) { return Math.floor(seconds / 60) + "m"; }
+		if (seconds < 86400) { return Math.floor(seconds / 3600) + "h " + Math.floor(seconds % 3600 / 60) + "m"; }
+		return Math.floor(seconds / 86400) + "d " + Math.floor(seconds % 86400 / 3600) + "h";
+	}
+
+	function windowText(current) {
+		if (!current) { return ""; }
+		var text = current.kind === "maintenance" ? " · Maintenance" : " · Quiet hours";
+		if (current.comment) { text += ": " + current.comment; }
+		return text + " until " + new Date(current.until).toLocaleString();
+	}
+
+	function latestCreated(branch) {
+		var latest = null;
+		(branch.statuses || []).forEach(function (status) {
+			var created = new Date(status.created);
+			if (created.getFullYear() > 1 && (!latest || created > latest)) { latest = created; }
+		});
+		return latest;
+	}
+
+	function element(tag, className, text) {
+		var el = document.createElement(tag);
+		if (className) { el.className = className; }
+		if (text !== undefined) { el.textContent = text; }
+		return el;
+	}
+
+	function tile(project, branch) {
+		var color = branchColor(branch);
+		var el = element(kiosk || !project.url ? "div" : "a", "tile " + color);
+		if (!kiosk && project.url) {
+			el.href = project.url + "/tree/" + encodeURIComponent(branch.name).replace(/%2F/g, "/");
+			el.target = "_blank";
+			el.rel = "noopener";
+		}
+
+		el.appendChild(element("h2", "", project.name));
+		el.appendChild(element("h3", "", branch.name + (branch.commit ? " @ " + branch.commit.substring(0, 8) : "")));
+
+		var list = element("ul");
+		(branch.statuses || []).forEach(function (status) {
+			if (color === "green" || (status.status !== "failed" && status.status !== "running" && status.status !== "pending" && status.status !== "unknown")) {
+				return;
+			}
+			var text = status.status === "failed" ? "✗ " : status.status === "unknown" ? "? " : "○ ";
+			text += status.name + (status.author ? " (" + status.author + ")" : "");
+			if (status.ack) { text += " — " + status.ack.comment + (status.ack.author ? " (" + status.ack.author + ")" : ""); }
+			list.appendChild(element("li", "", text));
+		});
+		el.appendChild(list);
+
+		if (branch.brokenBy) {
+			el.appendChild(element("div", "culprit", "Broken by " + branch.brokenBy + (branch.brokenCommit ? " @ " + branch.brokenCommit.substring(0, 8) : "")));
+		}
+
+		var created = latestCreated(branch);
+		if (created) {
+			el.appendChild(element("div", "elapsed", elapsed(created) + " ago"));
+		}
+
+		return el;
+	}
+
+	function fit(count) {
+		if (!kiosk || count === 0) { return; }
+		var tiles = document.getElementById("tiles");
+		var width = tiles.clientWidth;
+		var height = tiles.clientHeight;
+		var columns = Math.max(1, Math.ceil(Math.sqrt(count * width / height / 1.6)));
+		tiles.style.gridTemplateColumns = "repeat(" + columns + ", 1fr)";
+	}
+
+	function render() {
+		if (!summary) { return; }
+
+		var tiles = document.getElementById("tiles");
+		while (tiles.firstChild) { tiles.removeChild(tiles.firstChild); }
+
+		var count = 0;
+		(summary.projects || []).forEach(function (project) {
+			if (projectFilter && projectFilter.indexOf(project.name) < 0) { return; }
+			(project.branches || []).forEach(function (branch) {
+				if (branchFilter && branchFilter.indexOf(branch.name) < 0) { return; }
+				tiles.appendChild(tile(project, branch));
+				count++;
+			});
+		});
+
+		document.getElementById("empty").hidden = count > 0;
+		document.getElementById("overall").className = summary.color;
+		if (summary.lastUpdated) {
+			document.getElementById("updated").textContent = "Updated " + elapsed(new Date(summary.lastUpdated)) + " ago" + (summary.restored ? " (restored)" : "") + windowText(summary.window);
+		}
+		fit(count);
+	}
+
+	function load() {
+		var request = new XMLHttpRequest();
+		request.open("GET", "/api");
+		if (token) { request.setRequestHeader("Authorization", "bearer " + token); }
+		request.onload = function () {
+			if (request.status === 200) {
+				summary = JSON.parse(request.responseText);
+				render();
+			}
+		};
+		request.send();
+	}
+
+	function watch() {
+		var scheme = window.location.protocol === "https:" ? "wss://" : "ws://";
+		var socket = new WebSocket(scheme + window.location.host + "/api/watch");
+		socket.onmessage = function (event) {
+			summary = JSON.parse(event.data);
+			render();
+		};
+		socket.onclose = function () {
+			document.getElementById("overall").className = "question";
+			setTimeout(function () {
+				load();
+				watch();
+			}, 5000);
+		};
+	}
+
+	load();
+	watch();
+
+	// Refresh elapsed times and pick up changes that do not alter the overall
+	// color, which are not broadcast
+	setInterval(load, 30000);
+	setInterval(render, 10000);
+	window.addEventListener("resize", render);
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,53 @@
+package cistatus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/?kiosk&project=api", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("content type %q", contentType)
+	}
+
+	page := w.Body.String()
+	for _, want := range []string{"/api/watch", "body.kiosk"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("dashboard does not contain %q", want)
+		}
+	}
+
+	// Every color the API reports has a style
+	for _, c := range []Color{Red, Yellow, Green, Unknown, Acknowledged, Off, Maintenance} {
+		if !strings.Contains(page, "--"+string(c)+":") {
+			t.Errorf("dashboard has no style for %s", c)
+		}
+	}
+
+	for url, code := range map[string]int{
+		"/index.html": http.StatusNotFound,
+		"/missing":    http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != code {
+			t.Errorf("%s: status %d, want %d", url, w.Code, code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,202 @@
+package cistatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	keepalivePeriod = 15 * time.Second
+
+	// eventRetry is the reconnection delay suggested to event stream clients
+	eventRetry = 5 * time.Second
+)
+
+// sseEvent is a summary broadcast to event stream subscribers. IDs are the
+// epoch of the hub followed by a number increasing with every broadcast, so
+// that an ID from before a restart never matches one sent after it.
+type sseEvent struct {
+	ID      string
+	Summary Summary
+}
+
+// sseHub distributes summaries to Server-Sent Events subscribers. As each
+// summary is a complete snapshot only the latest event is kept; a slow
+// subscriber skips straight to the newest summary.
+type sseHub struct {
+	mu          sync.Mutex
+	subscribers map[chan sseEvent]bool
+	lastEvent   *sseEvent
+	epoch       string
+	nextID      uint64
+	closed      bool
+}
+
+// newSSEHub creates a new sseHub whose epoch is the time it was created
+func newSSEHub() *sseHub {
+	return &sseHub{
+		subscribers: make(map[chan sseEvent]bool),
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		nextID:      1,
+	}
+}
+
+// publish sends the summary to every subscriber
+func (h *sseHub) publish(summary Summary) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	event := sseEvent{
+		ID:      h.epoch + "-" + strconv.FormatUint(h.nextID, 10),
+		Summary: summary,
+	}
+	h.nextID++
+	h.lastEvent = &event
+
+	for events := range h.subscribers {
+		// Replace an undelivered summary with the newer one
+		select {
+		case <-events:
+		default:
+		}
+		events <- event
+	}
+}
+
+// subscribe registers a new subscriber and returns its channel along with
+// the latest event, if any. The channel is closed when the hub shuts down.
+func (h *sseHub) subscribe() (chan sseEvent, *sseEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make(chan sseEvent, 1)
+	if h.closed {
+		close(events)
+		return events, nil
+	}
+
+	h.subscribers[events] = true
+	return events, h.lastEvent
+}
+
+// unsubscribe removes the subscriber
+func (h *sseHub) unsubscribe(events chan sseEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[events] {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// connected returns the number of connected subscribers
+func (h *sseHub) connected() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers)
+}
+
+// shutdown closes every subscriber channel, ending their streams
+func (h *sseHub) shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for events := range h.subscribers {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// eventsHandler streams summaries as Server-Sent Events. Each event carries
+// the summary as JSON and an ID; a client reconnecting with the
+// Last-Event-ID header (or lastEventId query parameter) only receives the
+// current summary if it has changed since. Keepalive comments are sent
+// periodically so idle connections are not closed by proxies.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	authorized := s.isAuthorized(r)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	events, lastEvent := s.sseHub.subscribe()
+	defer s.sseHub.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Set("Server", "https://github.com/tantalic/cistatus")
+	w.Header().Set("X-Server-Version", Version)
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry/time.Millisecond)
+
+	switch {
+	case lastEvent == nil:
+		// Nothing has been broadcast yet, send the current summary
+		// without an ID so a reconnect does not skip the first event
+		writeEvent(w, nil, s.summary(), authorized)
+	case lastEventID != lastEvent.ID:
+		writeEvent(w, &lastEvent.ID, lastEvent.Summary, authorized)
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepalivePeriod)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(w, &event.ID, event.Summary, authorized)
+
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a summary event, removing the projects for unauthorized
+// clients as /api does
+func writeEvent(w http.ResponseWriter, id *string, summary Summary, authorized bool) {
+	if !authorized {
+		summary.Projects = []Project{}
+		summary.Culprits = nil
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return
+	}
+
+	if id != nil {
+		fmt.Fprintf(w, "id: %s\n", *id)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
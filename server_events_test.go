@@ -0,0 +1,50 @@
+package cistatus
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replay requests the event stream with a Last-Event-ID and returns what is
+// sent before the stream waits for the next event
+func replay(s *Server, lastEventID string) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := httptest.NewRequest("GET", "/api/events", nil).WithContext(ctx)
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	w := httptest.NewRecorder()
+	s.eventsHandler(w, r)
+	return w.Body.String()
+}
+
+func TestEventIDsAcrossRestarts(t *testing.T) {
+	before := NewServer(&staticFetcher{}, time.Minute)
+	before.sseHub.publish(Summary{Color: Red})
+	oldID := before.sseHub.lastEvent.ID
+
+	// A restarted server numbers its events from the start again
+	time.Sleep(time.Millisecond)
+	after := NewServer(&staticFetcher{}, time.Minute)
+	after.sseHub.publish(Summary{Color: Green})
+	newID := after.sseHub.lastEvent.ID
+
+	if oldID == newID {
+		t.Fatalf("the first event IDs of two servers are both %s", oldID)
+	}
+
+	body := replay(after, oldID)
+	if !strings.Contains(body, "id: "+newID+"\n") || !strings.Contains(body, `"color":"green"`) {
+		t.Errorf("a client reconnecting with an ID from before a restart did not receive the current summary:\n%s", body)
+	}
+
+	if body := replay(after, newID); strings.Contains(body, "data:") {
+		t.Errorf("a client with the latest event received it again:\n%s", body)
+	}
+}
@@ -0,0 +1,48 @@
+package cistatus
+
+import (
+	"net/http"
+)
+
+// flakyResource is the response body of /api/flaky
+type flakyResource struct {
+	Threshold float64    `json:"threshold"`
+	Jobs      []FlakyJob `json:"jobs"`
+}
+
+// flakyHandler serves the jobs that failed and then passed with the same
+// commit in their recent runs, flakiest first. Requests must be authorized
+// in the same way as the project resources. The project query parameter
+// selects the projects.
+func (s *Server) flakyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	projects := queryValues(r.URL.Query(), "project")
+
+	s.mu.RLock()
+	jobs := s.flaky.jobs()
+	s.mu.RUnlock()
+
+	resource := flakyResource{
+		Threshold: s.flakyThreshold(),
+		Jobs:      []FlakyJob{},
+	}
+	for _, job := range jobs {
+		if projects == nil || projects[job.Project] {
+			resource.Jobs = append(resource.Jobs, job)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// flakyThreshold returns the flakiness from which a job is flaky
+func (s *Server) flakyThreshold() float64 {
+	if s.FlakyThreshold > 0 {
+		return s.FlakyThreshold
+	}
+	return DefaultFlakyThreshold
+}
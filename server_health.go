@@ -0,0 +1,190 @@
+package cistatus
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// FetchCondition describes the outcome of the most recent poll of the
+// Fetcher.
+type FetchCondition string
+
+const (
+	// FetchPending means no poll has completed yet
+	FetchPending = FetchCondition("pending")
+	// FetchOK means the most recent poll succeeded
+	FetchOK = FetchCondition("ok")
+	// FetchFailed means the most recent poll returned an error
+	FetchFailed = FetchCondition("failed")
+	// FetchTimedOut means the most recent poll did not complete before
+	// the per-poll deadline
+	FetchTimedOut = FetchCondition("timedOut")
+)
+
+// FetchHealth describes how well the server has been fetching the CI status.
+type FetchHealth struct {
+	Condition           FetchCondition `json:"condition"`
+	LastAttempt         *time.Time     `json:"lastAttempt,omitempty"`
+	LastSuccess         *time.Time     `json:"lastSuccess,omitempty"`
+	LastError           string         `json:"lastError,omitempty"`
+	ConsecutiveFailures int            `json:"consecutiveFailures"`
+	TotalFailures       int            `json:"totalFailures"`
+	TotalTimeouts       int            `json:"totalTimeouts"`
+}
+
+// recordSuccess updates the health after a successful poll
+func (h *FetchHealth) recordSuccess(at time.Time) {
+	h.Condition = FetchOK
+	h.LastAttempt = &at
+	h.LastSuccess = &at
+	h.LastError = ""
+	h.ConsecutiveFailures = 0
+}
+
+// recordFailure updates the health after a failed poll. Polls that exceeded
+// their deadline are recorded as FetchTimedOut rather than FetchFailed.
+func (h *FetchHealth) recordFailure(at time.Time, err error, timedOut bool) {
+	h.Condition = FetchFailed
+	if timedOut {
+		h.Condition = FetchTimedOut
+		h.TotalTimeouts++
+	}
+
+	h.LastAttempt = &at
+	h.LastError = err.Error()
+	h.ConsecutiveFailures++
+	h.TotalFailures++
+}
+
+// FetchHealth returns the current health of the fetch loop
+func (s *Server) FetchHealth() FetchHealth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.fetchHealth
+}
+
+const (
+	// DefaultReadyIntervals is the default for Server.ReadyIntervals
+	DefaultReadyIntervals = 3
+
+	// hubPingTimeout is how long the liveness check waits for the
+	// WebSocket hub to respond
+	hubPingTimeout = time.Second
+)
+
+// healthCheck is the result of a single liveness or readiness check
+type healthCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// healthReport is the response body of /healthz and /readyz
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks"`
+	Failed []string      `json:"failed,omitempty"`
+}
+
+func newHealthReport(checks ...healthCheck) healthReport {
+	report := healthReport{
+		Status: "ok",
+		Checks: checks,
+	}
+
+	for _, check := range checks {
+		if !check.OK {
+			report.Status = "failing"
+			report.Failed = append(report.Failed, check.Name)
+		}
+	}
+
+	return report
+}
+
+func writeHealthReport(w http.ResponseWriter, report healthReport) {
+	code := http.StatusOK
+	if report.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, code, report)
+}
+
+// livenessHandler reports whether the process is alive: the WebSocket hub
+// answers and the fetch loop has not exited.
+func (s *Server) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	hub := healthCheck{
+		Name: "hub",
+		OK:   s.wsHub.responsive(hubPingTimeout),
+	}
+	if !hub.OK {
+		hub.Message = fmt.Sprintf("websocket hub did not respond within %s", hubPingTimeout)
+	}
+
+	fetchLoop := healthCheck{
+		Name: "fetchLoop",
+		OK:   true,
+	}
+	select {
+	case <-s.fetchDone:
+		fetchLoop.OK = false
+		fetchLoop.Message = "fetch loop has stopped"
+	default:
+	}
+
+	writeHealthReport(w, newHealthReport(hub, fetchLoop))
+}
+
+// readinessHandler reports whether the server has current data to serve:
+// a fetch has succeeded since the server started and the last success was
+// within ReadyIntervals fetch intervals. The last success restored from the
+// state file does not count until this process has fetched.
+func (s *Server) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	health := s.FetchHealth()
+
+	s.mu.Lock()
+	restored := s.restored
+	s.mu.Unlock()
+
+	intervals := s.ReadyIntervals
+	if intervals <= 0 {
+		intervals = DefaultReadyIntervals
+	}
+	maxAge := time.Duration(intervals) * s.fetchInterval
+
+	fetched := healthCheck{
+		Name: "fetched",
+		OK:   health.LastSuccess != nil && !restored,
+	}
+	if !fetched.OK {
+		fetched.Message = "no successful fetch yet"
+	}
+
+	fresh := healthCheck{
+		Name: "fresh",
+		OK:   fetched.OK && time.Since(*health.LastSuccess) <= maxAge,
+	}
+	if !fresh.OK {
+		fresh.Message = fmt.Sprintf("no successful fetch within %s (%s)", maxAge, health.Condition)
+		if health.LastError != "" {
+			fresh.Message += ": " + health.LastError
+		}
+	}
+
+	running := healthCheck{
+		Name: "running",
+		OK:   true,
+	}
+	select {
+	case <-s.stop:
+		running.OK = false
+		running.Message = "server is shutting down"
+	default:
+	}
+
+	writeHealthReport(w, newHealthReport(fetched, fresh, running))
+}
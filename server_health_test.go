@@ -0,0 +1,65 @@
+package cistatus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// blockingFetcher blocks every poll until its context is done
+type blockingFetcher struct {
+	deadline time.Time
+}
+
+func (f *blockingFetcher) FetchStatus(ctx context.Context) ([]Project, error) {
+	f.deadline, _ = ctx.Deadline()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestFetchTimeout(t *testing.T) {
+	tests := []struct {
+		interval, timeout, want time.Duration
+	}{
+		{time.Minute, 0, 45 * time.Second},
+		{time.Minute, 10 * time.Second, 10 * time.Second},
+		{time.Minute, time.Minute, 45 * time.Second},
+		{time.Minute, 2 * time.Minute, 45 * time.Second},
+	}
+
+	for _, test := range tests {
+		s := NewServer(&staticFetcher{}, test.interval)
+		s.FetchTimeout = test.timeout
+		if got := s.fetchTimeout(); got != test.want {
+			t.Errorf("interval %s, timeout %s: got %s, want %s", test.interval, test.timeout, got, test.want)
+		}
+	}
+}
+
+func TestFetchDeadline(t *testing.T) {
+	fetcher := &blockingFetcher{}
+	s := NewServer(fetcher, time.Minute)
+	s.FetchTimeout = 20 * time.Millisecond
+
+	start := time.Now()
+	s.fetch(context.Background(), false)
+
+	if fetcher.deadline.IsZero() || fetcher.deadline.Sub(start) > s.FetchTimeout+time.Second {
+		t.Errorf("poll deadline %s after the start, want %s", fetcher.deadline.Sub(start), s.FetchTimeout)
+	}
+
+	health := s.FetchHealth()
+	if health.Condition != FetchTimedOut || health.TotalTimeouts != 1 || health.ConsecutiveFailures != 1 {
+		t.Errorf("a poll past its deadline was not recorded as timed out: %+v", health)
+	}
+
+	// A poll cancelled by shutdown is not a failure
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.fetch(ctx, false)
+
+	health = s.FetchHealth()
+	if health.ConsecutiveFailures != 1 {
+		t.Errorf("a cancelled poll was recorded as a failure: %+v", health)
+	}
+}
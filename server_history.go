@@ -0,0 +1,135 @@
+package cistatus
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// historyResource is the response body of /api/history. Next is the URL of
+// the following (older) page, if there is one.
+type historyResource struct {
+	Transitions []Transition `json:"transitions"`
+	Next        string       `json:"next,omitempty"`
+}
+
+// historyHandler serves the recorded transitions, newest first. Requests
+// must be authorized in the same way as the project resources. The query
+// parameters are:
+//
+//	since, until  RFC3339 time or a duration before now, such as 24h
+//	kind          "job" or "color"
+//	project, branch, job, state
+//	              only matching transitions (repeatable or comma separated)
+//	limit         page size, up to 1000
+//	before        only transitions with a lower id, used by next
+func (s *Server) historyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if s.History == nil {
+		http.Error(w, "history is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	q, limit, err := parseHistoryQuery(query, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transitions, more, err := s.History.Query(q, limit)
+	if err != nil {
+		s.Logger.Printf("Error querying history: %s\n", err)
+		http.Error(w, "unable to read history", http.StatusInternalServerError)
+		return
+	}
+
+	resource := historyResource{
+		Transitions: transitions,
+	}
+	if more {
+		query.Set("before", strconv.FormatInt(transitions[len(transitions)-1].ID, 10))
+		resource.Next = r.URL.Path + "?" + query.Encode()
+	}
+
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// parseHistoryQuery parses the query parameters of /api/history
+func parseHistoryQuery(query url.Values, now time.Time) (HistoryQuery, int, error) {
+	var err error
+
+	q := HistoryQuery{
+		Kind:     query.Get("kind"),
+		Projects: queryValues(query, "project"),
+		Branches: queryValues(query, "branch"),
+		Jobs:     queryValues(query, "job"),
+		States:   queryValues(query, "state"),
+	}
+
+	if q.Kind != "" && q.Kind != JobTransition && q.Kind != ColorTransition {
+		return q, 0, errors.Errorf("invalid kind %q", q.Kind)
+	}
+
+	q.Since, err = parseHistoryTime(query.Get("since"), now)
+	if err != nil {
+		return q, 0, errors.Wrap(err, "invalid since")
+	}
+
+	q.Until, err = parseHistoryTime(query.Get("until"), now)
+	if err != nil {
+		return q, 0, errors.Wrap(err, "invalid until")
+	}
+
+	if before := query.Get("before"); before != "" {
+		q.Before, err = strconv.ParseInt(before, 10, 64)
+		if err != nil || q.Before <= 0 {
+			return q, 0, errors.Errorf("invalid before %q", before)
+		}
+	}
+
+	limit := defaultHistoryLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return q, 0, errors.Errorf("invalid limit %q", value)
+		}
+		if limit > maxHistoryLimit {
+			limit = maxHistoryLimit
+		}
+	}
+
+	return q, limit, nil
+}
+
+// parseHistoryTime parses an RFC3339 time or a duration before now. It is
+// the zero time when value is empty.
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, errors.Errorf("%q is neither a time nor a duration", value)
+	}
+
+	return now.Add(-d), nil
+}
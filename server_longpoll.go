@@ -0,0 +1,74 @@
+package cistatus
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxLongPollWait is the longest a request may wait for the summary to
+// change
+const maxLongPollWait = 5 * time.Minute
+
+// summaryETag returns a weak ETag for the summary. LastUpdated changes on
+// every poll so it is excluded; the ETag only changes with the content.
+func summaryETag(summary Summary) string {
+	summary.LastUpdated = nil
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return ""
+	}
+
+	return contentETag(data)
+}
+
+// contentETag returns a weak ETag for a response body
+func contentETag(data []byte) string {
+	sum := sha1.Sum(data)
+	return `W/"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// longPollWait parses the wait query parameter, such as "60s" or "60"
+// (seconds). It is zero when not set and capped at maxLongPollWait.
+func longPollWait(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("wait")
+	if value == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		wait, err = time.ParseDuration(value + "s")
+	}
+	if err != nil || wait < 0 {
+		return 0, errors.Errorf("invalid wait %q", value)
+	}
+
+	if wait > maxLongPollWait {
+		wait = maxLongPollWait
+	}
+
+	return wait, nil
+}
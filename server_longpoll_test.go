@@ -0,0 +1,133 @@
+package cistatus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSummaryETag(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.mu.Lock()
+	s.fetchedProjects = []Project{{Name: "api", Branches: []Branch{{Name: "master", Statuses: []Status{{Name: "test", Status: "success"}}}}}}
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api", nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status %d, ETag %q", w.Code, etag)
+	}
+
+	// An unchanged poll only updates LastUpdated
+	s.mu.Lock()
+	s.rebuildSummary(time.Now().Add(time.Minute))
+	s.mu.Unlock()
+
+	if w := get(etag); w.Code != http.StatusNotModified {
+		t.Errorf("unchanged summary: status %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w := get(`"other", ` + etag); w.Code != http.StatusNotModified {
+		t.Errorf("list of ETags: status %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	s.mu.Lock()
+	s.fetchedProjects[0].Branches[0].Statuses[0].Status = "failed"
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	if w := get(etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("changed summary: status %d, ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestLongPoll(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.mu.Lock()
+	s.fetchedProjects = []Project{{Name: "api", Branches: []Branch{{Name: "master", Statuses: []Status{{Name: "test", Status: "running"}}}}}}
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	etag := w.Header().Get("ETag")
+
+	poll := func(wait string) chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			r := httptest.NewRequest("GET", "/api?wait="+wait, nil)
+			r.Header.Set("If-None-Match", etag)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			done <- w
+		}()
+		return done
+	}
+
+	// The wait expires without a change
+	start := time.Now()
+	w = <-poll("50ms")
+	if w.Code != http.StatusNotModified || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("expired wait: status %d after %s", w.Code, time.Since(start))
+	}
+
+	// An unchanged poll does not end the wait, a change does
+	done := poll("10s")
+	time.Sleep(20 * time.Millisecond)
+	s.mu.Lock()
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	select {
+	case w := <-done:
+		t.Fatalf("unchanged poll ended the wait with status %d", w.Code)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	s.mu.Lock()
+	s.fetchedProjects[0].Branches[0].Statuses[0].Status = "success"
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	select {
+	case w := <-done:
+		if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+			t.Errorf("changed summary: status %d, ETag %q", w.Code, w.Header().Get("ETag"))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a change did not end the wait")
+	}
+}
+
+func TestLongPollWait(t *testing.T) {
+	tests := []struct {
+		wait string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, true},
+		{"30", 30 * time.Second, true},
+		{"1m", time.Minute, true},
+		{"1h", maxLongPollWait, true},
+		{"-1s", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := longPollWait(httptest.NewRequest("GET", "/api?wait="+test.wait, nil))
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("wait %q: got %s, %v", test.wait, got, err)
+		}
+	}
+}
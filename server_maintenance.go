@@ -0,0 +1,208 @@
+package cistatus
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaintenanceWindow is a period during which the summary color is
+// Maintenance and notifications are held
+type MaintenanceWindow struct {
+	ID      int       `json:"id"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Comment string    `json:"comment"`
+	Author  string    `json:"author,omitempty"`
+}
+
+func (m MaintenanceWindow) activeAt(t time.Time) bool {
+	return !t.Before(m.Start) && t.Before(m.End)
+}
+
+// maintenanceRequest is the payload accepted by POST /api/maintenance
+type maintenanceRequest struct {
+	// Start is an RFC 3339 time, now when empty
+	Start string `json:"start"`
+	// End is an RFC 3339 time, or Duration (such as "2h") the length of
+	// the window
+	End      string `json:"end"`
+	Duration string `json:"duration"`
+	Comment  string `json:"comment"`
+	Author   string `json:"author"`
+}
+
+// window validates the request and returns the window it describes
+func (m maintenanceRequest) window(now time.Time) (MaintenanceWindow, error) {
+	w := MaintenanceWindow{
+		Start:   now,
+		Comment: m.Comment,
+		Author:  m.Author,
+	}
+
+	if m.Comment == "" {
+		return w, errors.New("comment is required")
+	}
+
+	var err error
+	if m.Start != "" {
+		w.Start, err = time.Parse(time.RFC3339, m.Start)
+		if err != nil {
+			return w, errors.New("invalid start, expected an RFC 3339 time")
+		}
+	}
+
+	switch {
+	case m.End != "" && m.Duration != "":
+		return w, errors.New("end and duration are mutually exclusive")
+	case m.End != "":
+		w.End, err = time.Parse(time.RFC3339, m.End)
+		if err != nil {
+			return w, errors.New("invalid end, expected an RFC 3339 time")
+		}
+	case m.Duration != "":
+		d, err := time.ParseDuration(m.Duration)
+		if err != nil || d <= 0 {
+			return w, errors.New("invalid duration")
+		}
+		w.End = w.Start.Add(d)
+	default:
+		return w, errors.New("end or duration is required")
+	}
+
+	if !w.End.After(w.Start) || !w.End.After(now) {
+		return w, errors.New("the window must end after it starts and in the future")
+	}
+
+	return w, nil
+}
+
+// maintenanceResource is the response body of GET /api/maintenance
+type maintenanceResource struct {
+	Windows []MaintenanceWindow `json:"windows"`
+	Active  *Window             `json:"active,omitempty"`
+}
+
+// maintenanceHandler lists (GET), schedules (POST) and cancels (DELETE)
+// maintenance windows. Requests must be authorized in the same way as /api.
+// DELETE cancels the window given by the id query parameter or, without
+// one, every window in progress.
+func (s *Server) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		s.mu.RLock()
+		resource := maintenanceResource{
+			Windows: append([]MaintenanceWindow{}, s.maintenance...),
+			Active:  s.latestSummary.Window,
+		}
+		s.mu.RUnlock()
+
+		writeJSON(w, http.StatusOK, resource)
+	case "POST":
+		s.postMaintenance(w, r)
+	case "DELETE":
+		s.deleteMaintenance(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) postMaintenance(w http.ResponseWriter, r *http.Request) {
+	var m maintenanceRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushPayloadSize)).Decode(&m)
+	if err != nil {
+		http.Error(w, "unable to parse maintenance window", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	window, err := m.window(now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	window.ID = 1
+	for _, existing := range s.maintenance {
+		if existing.ID >= window.ID {
+			window.ID = existing.ID + 1
+		}
+	}
+	s.maintenance = append(s.maintenance, window)
+	changed := s.rebuildSummary(now)
+	s.scheduleWindowChange(now)
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	s.Logger.Printf("Scheduled maintenance from %s to %s: %s\n", window.Start, window.End, window.Comment)
+	if changed {
+		s.publish(summary)
+	} else {
+		s.saveState()
+	}
+
+	writeJSON(w, http.StatusCreated, window)
+}
+
+func (s *Server) deleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	id := 0
+	if value := r.URL.Query().Get("id"); value != "" {
+		var err error
+		id, err = strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	windows := s.maintenance[:0:0]
+	for _, m := range s.maintenance {
+		if m.ID == id || (id == 0 && m.activeAt(now)) {
+			continue
+		}
+		windows = append(windows, m)
+	}
+	if len(windows) == len(s.maintenance) {
+		s.mu.Unlock()
+		http.Error(w, "maintenance window not found", http.StatusNotFound)
+		return
+	}
+	s.maintenance = windows
+	changed := s.rebuildSummary(now)
+	s.scheduleWindowChange(now)
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	s.Logger.Println("Cancelled maintenance")
+	if changed {
+		s.publish(summary)
+	} else {
+		s.saveState()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// endMaintenance returns windows without the ones that ended by now
+func endMaintenance(windows []MaintenanceWindow, now time.Time) []MaintenanceWindow {
+	kept := windows[:0:0]
+	for _, m := range windows {
+		if now.Before(m.End) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,232 @@
+package cistatus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// fetchDurationBuckets are the upper bounds, in seconds, of the fetch
+// duration histogram
+var fetchDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metricColors are the colors reported by the color gauges
+var metricColors = []Color{Green, Yellow, Red, Acknowledged, Unknown, Off, Maintenance}
+
+// serverMetrics holds the counters that are not already part of the server
+// state
+type serverMetrics struct {
+	// broadcasts is first in the struct to keep it 64-bit aligned for
+	// atomic access
+	broadcasts uint64
+
+	fetchDurations *histogram
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		fetchDurations: newHistogram(fetchDurationBuckets),
+	}
+}
+
+// histogram is a minimal Prometheus style cumulative histogram
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (h *histogram) write(b *bytes.Buffer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
+
+// metricsHandler serves the server metrics in the Prometheus text
+// exposition format. Requests must be authorized in the same way as the
+// project resources.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.RLock()
+	summary := s.latestSummary
+	health := s.fetchHealth
+	s.mu.RUnlock()
+
+	var b bytes.Buffer
+
+	jobs, branches := metricSeries(summary.Projects)
+
+	writeMetricHeader(&b, "cistatus_job_state", "gauge", "Current state of each job, the state is given by the state label.")
+	for _, job := range jobs {
+		writeMetric(&b, "cistatus_job_state", 1,
+			"project", job.project, "branch", job.branch, "job", job.job, "state", job.status.Status)
+	}
+
+	writeMetricHeader(&b, "cistatus_branch_color", "gauge", "Whether each branch currently has the color given by the color label.")
+	policy := s.colorPolicy()
+	for _, branch := range branches {
+		current := color([]Project{{Branches: branch.branches}}, policy)
+		for _, c := range metricColors {
+			writeMetric(&b, "cistatus_branch_color", boolValue(c == current),
+				"project", branch.project, "branch", branch.name, "color", string(c))
+		}
+	}
+
+	writeMetricHeader(&b, "cistatus_color", "gauge", "Whether the overall summary currently has the color given by the color label.")
+	for _, c := range metricColors {
+		writeMetric(&b, "cistatus_color", boolValue(c == summary.Color), "color", string(c))
+	}
+
+	writeMetricHeader(&b, "cistatus_fetch_duration_seconds", "histogram", "Duration of polls of the CI server.")
+	s.metrics.fetchDurations.write(&b, "cistatus_fetch_duration_seconds")
+
+	writeMetricHeader(&b, "cistatus_fetch_errors_total", "counter", "Polls of the CI server that failed, by reason.")
+	writeMetric(&b, "cistatus_fetch_errors_total", float64(health.TotalFailures-health.TotalTimeouts), "reason", "error")
+	writeMetric(&b, "cistatus_fetch_errors_total", float64(health.TotalTimeouts), "reason", "timeout")
+
+	writeMetricHeader(&b, "cistatus_last_successful_fetch_timestamp_seconds", "gauge", "Unix time of the last successful poll of the CI server.")
+	var lastSuccess float64
+	if health.LastSuccess != nil {
+		lastSuccess = float64(health.LastSuccess.UnixNano()) / 1e9
+	}
+	writeMetric(&b, "cistatus_last_successful_fetch_timestamp_seconds", lastSuccess)
+
+	writeMetricHeader(&b, "cistatus_websocket_subscribers", "gauge", "Connected WebSocket subscribers.")
+	writeMetric(&b, "cistatus_websocket_subscribers", float64(s.wsHub.connected()))
+
+	writeMetricHeader(&b, "cistatus_event_stream_subscribers", "gauge", "Connected Server-Sent Events subscribers.")
+	writeMetric(&b, "cistatus_event_stream_subscribers", float64(s.sseHub.connected()))
+
+	writeMetricHeader(&b, "cistatus_messages_broadcast_total", "counter", "Summaries broadcast to subscribers.")
+	writeMetric(&b, "cistatus_messages_broadcast_total", float64(atomic.LoadUint64(&s.metrics.broadcasts)))
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Server", "https://github.com/tantalic/cistatus")
+	w.Header().Set("X-Server-Version", Version)
+	b.WriteTo(w)
+}
+
+// jobSeries is the latest status of a job for cistatus_job_state
+type jobSeries struct {
+	project, branch, job string
+	status               Status
+}
+
+// branchSeries is every branch of a name for cistatus_branch_color
+type branchSeries struct {
+	project, name string
+	branches      []Branch
+}
+
+// metricSeries aggregates the jobs and branches of projects by the labels
+// of their series, as fetchers may report several runs of a job or several
+// projects or branches of the same name and a scrape with duplicate series
+// is rejected. The latest status of a job is kept.
+func metricSeries(projects []Project) ([]jobSeries, []branchSeries) {
+	var jobs []jobSeries
+	var branches []branchSeries
+	jobIndex := make(map[jobKey]int)
+	branchIndex := make(map[branchKey]int)
+
+	for _, project := range projects {
+		for _, branch := range project.Branches {
+			key := branchKey{project.Name, branch.Name}
+			if i, ok := branchIndex[key]; ok {
+				branches[i].branches = append(branches[i].branches, branch)
+			} else {
+				branchIndex[key] = len(branches)
+				branches = append(branches, branchSeries{project.Name, branch.Name, []Branch{branch}})
+			}
+
+			for _, status := range branch.Statuses {
+				key := jobKey{project.Name, branch.Name, status.Name}
+				i, ok := jobIndex[key]
+				switch {
+				case !ok:
+					jobIndex[key] = len(jobs)
+					jobs = append(jobs, jobSeries{project.Name, branch.Name, status.Name, status})
+				case !status.Created.Before(jobs[i].status.Created):
+					jobs[i].status = status
+				}
+			}
+		}
+	}
+
+	return jobs, branches
+}
+
+func writeMetricHeader(b *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+// writeMetric writes a sample. labels are given as name, value pairs.
+func writeMetric(b *bytes.Buffer, name string, value float64, labels ...string) {
+	b.WriteString(name)
+
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1])))
+		}
+		sort.Strings(pairs)
+		b.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+
+	b.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,54 @@
+package cistatus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsWithoutDuplicateSeries(t *testing.T) {
+	created := time.Now()
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.mu.Lock()
+	s.fetchedProjects = []Project{
+		{Name: "api", Branches: []Branch{
+			{Name: "master", Statuses: []Status{
+				{Name: "test", Status: "success", Created: created.Add(time.Minute)},
+				{Name: "test", Status: "failed", Created: created},
+			}},
+			{Name: "master", Statuses: []Status{{Name: "lint", Status: "running", Created: created}}},
+		}},
+	}
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	w := httptest.NewRecorder()
+	s.metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		series := line[:strings.LastIndex(line, " ")]
+		if seen[series] {
+			t.Errorf("duplicate series %s", series)
+		}
+		seen[series] = true
+	}
+
+	for _, want := range []string{
+		`cistatus_job_state{branch="master",job="test",project="api",state="success"}`,
+		`cistatus_job_state{branch="master",job="lint",project="api",state="running"}`,
+		`cistatus_branch_color{branch="master",color="red",project="api"}`,
+	} {
+		if !seen[want] {
+			t.Errorf("missing series %s:\n%s", want, w.Body)
+		}
+	}
+	if seen[`cistatus_job_state{branch="master",job="test",project="api",state="failed"}`] {
+		t.Error("the state of an older run of a job was exported")
+	}
+}
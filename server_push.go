@@ -0,0 +1,152 @@
+package cistatus
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxPushPayloadSize = 64 * 1024
+
+	// expiredStatus is the status of a pushed status once its TTL passes,
+	// which makes the color Unknown rather than leaving it green
+	expiredStatus = UnknownStatus
+)
+
+// validPushStates are the states accepted by the status push API. They
+// match the GitLab status names used throughout cistatus.
+var validPushStates = map[string]bool{
+	"created":  true,
+	"pending":  true,
+	"running":  true,
+	"success":  true,
+	"failed":   true,
+	"canceled": true,
+	"skipped":  true,
+	"manual":   true,
+}
+
+// pushedStatus is the payload accepted by POST /api/statuses
+type pushedStatus struct {
+	Project string `json:"project"`
+	Branch  string `json:"branch"`
+	Commit  string `json:"commit"`
+	Job     string `json:"job"`
+	State   string `json:"state"`
+	Author  string `json:"author"`
+	// TTL is a duration (such as "26h") after which the status expires
+	// to unknown. Statuses without a TTL never expire.
+	TTL string `json:"ttl"`
+}
+
+func (p pushedStatus) validate() error {
+	if p.Project == "" || p.Branch == "" || p.Job == "" {
+		return errors.New("project, branch and job are required")
+	}
+
+	if !validPushStates[p.State] {
+		return errors.Errorf("invalid state %q", p.State)
+	}
+
+	return nil
+}
+
+// pushStatusHandler accepts statuses from scripts and CI systems without a
+// Fetcher. Requests must be authorized in the same way as /api.
+func (s *Server) pushStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.isAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var p pushedStatus
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushPayloadSize)).Decode(&p)
+	if err != nil {
+		http.Error(w, "unable to parse status", http.StatusBadRequest)
+		return
+	}
+
+	err = p.validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if p.TTL != "" {
+		ttl, err = time.ParseDuration(p.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	status := Status{
+		Name:    p.Job,
+		Status:  p.State,
+		Created: time.Now(),
+		Author:  p.Author,
+	}
+	if ttl > 0 {
+		expires := status.Created.Add(ttl)
+		status.Expires = &expires
+	}
+
+	s.pushStatus(p.Project, p.Branch, p.Commit, status)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pushStatus adds status to the pushed projects and schedules its expiry. A
+// status pushed without a commit is kept without one so that it is merged
+// onto whatever commit the fetched branch is at.
+func (s *Server) pushStatus(project, branch, commit string, status Status) {
+	s.PushBranch(project, Branch{
+		Name:     branch,
+		Commit:   commit,
+		Statuses: []Status{status},
+	})
+
+	if status.Expires != nil {
+		time.AfterFunc(status.Expires.Sub(status.Created), func() {
+			s.expireStatus(project, branch, status.Name)
+		})
+	}
+}
+
+// expireStatus sets a pushed status to unknown if its TTL has passed. A
+// status pushed again since the timer was scheduled will have a later
+// expiry (or none) and is left alone.
+func (s *Server) expireStatus(project, branch, name string) {
+	now := time.Now()
+
+	s.mu.Lock()
+	status, commit, ok := findStatus(s.pushedProjects, project, branch, name)
+	if !ok || status.Expires == nil || now.Before(*status.Expires) {
+		s.mu.Unlock()
+		return
+	}
+
+	status.Status = expiredStatus
+	status.Expires = nil
+	s.pushedProjects = mergeBranch(s.pushedProjects, project, Branch{
+		Name:     branch,
+		Commit:   commit,
+		Statuses: []Status{status},
+	})
+	s.rebuildSummary(now)
+	summary := s.latestSummary
+	s.mu.Unlock()
+
+	s.Logger.Printf("Pushed status %s for %s project, %s branch expired\n", name, project, branch)
+	s.publish(summary)
+}
@@ -0,0 +1,281 @@
+package cistatus
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// projectsResource is the response for /api/projects
+type projectsResource struct {
+	Projects []projectResource `json:"projects"`
+	Color    Color             `json:"color"`
+}
+
+// projectResource is the response for /api/projects/{id}
+type projectResource struct {
+	Name     string           `json:"name"`
+	URL      string           `json:"url,omitempty"`
+	Color    Color            `json:"color"`
+	Branches []branchResource `json:"branches"`
+}
+
+// branchResource is the response for /api/projects/{id}/branches/{branch}
+type branchResource struct {
+	Branch
+	Color Color `json:"color"`
+}
+
+// statusesResource is the response for
+// /api/projects/{id}/branches/{branch}/statuses
+type statusesResource struct {
+	Statuses []Status `json:"statuses"`
+	Color    Color    `json:"color"`
+}
+
+func newProjectResource(project Project, policy colorPolicy) projectResource {
+	p := projectResource{
+		Name:     project.Name,
+		URL:      project.URL,
+		Color:    projectColor(project, policy),
+		Branches: make([]branchResource, 0, len(project.Branches)),
+	}
+
+	for _, branch := range project.Branches {
+		p.Branches = append(p.Branches, branchResource{
+			Branch: branch,
+			Color:  branchColor(branch, policy),
+		})
+	}
+
+	return p
+}
+
+// projectsHandler serves the project, branch and status resources below
+// /api/projects. Branch names may contain slashes, project names only when
+// escaped as %2F.
+func (s *Server) projectsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.isAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter := newResourceFilter(r.URL.Query())
+	projects := s.summary().Projects
+	policy := s.colorPolicy()
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/api/projects"), "/")
+	if path == "" {
+		filtered := filter.projects(projects)
+		resource := projectsResource{
+			Projects: make([]projectResource, 0, len(filtered)),
+			Color:    color(filtered, policy),
+		}
+		for _, project := range filtered {
+			resource.Projects = append(resource.Projects, newProjectResource(project, policy))
+		}
+
+		writeJSON(w, http.StatusOK, resource)
+		return
+	}
+
+	projectName, branchPath, ok := splitProjectPath(path)
+	if !ok {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	project, ok := findProject(projects, projectName)
+	if !ok {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+
+	if branchPath == "" {
+		writeJSON(w, http.StatusOK, newProjectResource(project, policy))
+		return
+	}
+
+	if !strings.HasPrefix(branchPath, "branches/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	branchName := strings.TrimPrefix(branchPath, "branches/")
+	statuses := strings.HasSuffix(branchName, "/statuses")
+	branchName = strings.TrimSuffix(branchName, "/statuses")
+
+	branch, ok := findBranch(project, branchName)
+	if !ok {
+		http.Error(w, "branch not found", http.StatusNotFound)
+		return
+	}
+
+	if !statuses {
+		writeJSON(w, http.StatusOK, branchResource{
+			Branch: branch,
+			Color:  branchColor(branch, policy),
+		})
+		return
+	}
+
+	filtered := filter.statuses(branch.Statuses)
+	writeJSON(w, http.StatusOK, statusesResource{
+		Statuses: filtered,
+		Color:    branchColor(Branch{Statuses: filtered}, policy),
+	})
+}
+
+// splitProjectPath splits an escaped path into the unescaped project name,
+// its first segment, and the unescaped rest of the path
+func splitProjectPath(escaped string) (string, string, bool) {
+	project, rest := escaped, ""
+	if i := strings.Index(escaped, "/"); i >= 0 {
+		project, rest = escaped[:i], escaped[i+1:]
+	}
+
+	project, err := url.PathUnescape(project)
+	if err != nil {
+		return "", "", false
+	}
+	rest, err = url.PathUnescape(rest)
+	if err != nil {
+		return "", "", false
+	}
+
+	return project, rest, true
+}
+
+func findProject(projects []Project, name string) (Project, bool) {
+	for _, project := range projects {
+		if project.Name == name {
+			return project, true
+		}
+	}
+
+	return Project{}, false
+}
+
+func findBranch(project Project, name string) (Branch, bool) {
+	for _, branch := range project.Branches {
+		if branch.Name == name {
+			return branch, true
+		}
+	}
+
+	return Branch{}, false
+}
+
+// resourceFilter restricts collections to the statuses, branches and
+// projects matching the state, author, job, branch and project query
+// parameters. Each parameter may be repeated or contain a comma separated
+// list of values.
+type resourceFilter struct {
+	projectNames map[string]bool
+	states       map[string]bool
+	authors      map[string]bool
+	jobs         map[string]bool
+	branches     map[string]bool
+}
+
+func newResourceFilter(query url.Values) resourceFilter {
+	return resourceFilter{
+		projectNames: queryValues(query, "project"),
+		states:       queryValues(query, "state"),
+		authors:      queryValues(query, "author"),
+		jobs:         queryValues(query, "job"),
+		branches:     queryValues(query, "branch"),
+	}
+}
+
+func queryValues(query url.Values, key string) map[string]bool {
+	var values map[string]bool
+
+	for _, value := range query[key] {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+
+			if values == nil {
+				values = make(map[string]bool)
+			}
+			values[v] = true
+		}
+	}
+
+	return values
+}
+
+// filtersStatuses reports whether the filter applies to statuses
+func (f resourceFilter) filtersStatuses() bool {
+	return f.states != nil || f.authors != nil || f.jobs != nil
+}
+
+// projects returns the projects with only the matching branches and
+// statuses. Branches and projects left empty by the filter are removed.
+func (f resourceFilter) projects(projects []Project) []Project {
+	filtered := make([]Project, 0, len(projects))
+
+	for _, project := range projects {
+		if f.projectNames != nil && !f.projectNames[project.Name] {
+			continue
+		}
+
+		branches := make([]Branch, 0, len(project.Branches))
+
+		for _, branch := range project.Branches {
+			if f.branches != nil && !f.branches[branch.Name] {
+				continue
+			}
+
+			if f.filtersStatuses() {
+				branch.Statuses = f.statuses(branch.Statuses)
+				if len(branch.Statuses) == 0 {
+					continue
+				}
+			}
+
+			branches = append(branches, branch)
+		}
+
+		if len(branches) == 0 && (f.branches != nil || f.filtersStatuses()) {
+			continue
+		}
+
+		project.Branches = branches
+		filtered = append(filtered, project)
+	}
+
+	return filtered
+}
+
+// statuses returns the statuses matching the state, author and job filters
+func (f resourceFilter) statuses(statuses []Status) []Status {
+	filtered := make([]Status, 0, len(statuses))
+
+	for _, status := range statuses {
+		if f.states != nil && !f.states[status.Status] {
+			continue
+		}
+
+		if f.authors != nil && !f.authors[status.Author] {
+			continue
+		}
+
+		if f.jobs != nil && !f.jobs[status.Name] {
+			continue
+		}
+
+		filtered = append(filtered, status)
+	}
+
+	return filtered
+}
@@ -0,0 +1,109 @@
+package cistatus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProjectPaths(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.mu.Lock()
+	s.fetchedProjects = []Project{
+		{Name: "zone-a:api", Branches: []Branch{{Name: "feature/x", Statuses: []Status{{Name: "test", Status: "success"}}}}},
+		{Name: "group/web", Branches: []Branch{{Name: "master", Statuses: []Status{{Name: "test", Status: "failed"}}}}},
+	}
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{"/api/projects/zone-a:api", http.StatusOK},
+		{"/api/projects/zone-a:api/branches/feature/x", http.StatusOK},
+		{"/api/projects/zone-a:api/branches/feature%2Fx/statuses", http.StatusOK},
+		{"/api/projects/group%2Fweb/branches/master", http.StatusOK},
+		{"/api/projects/group/web", http.StatusNotFound},
+		{"/badge/zone-a:api/feature/x.svg", http.StatusOK},
+		{"/badge/group%2Fweb.svg", http.StatusOK},
+		{"/badge/group/web.svg", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: status %d, want %d: %s", test.url, w.Code, test.code, w.Body)
+		}
+	}
+}
+
+func TestProjectResources(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	s.mu.Lock()
+	s.fetchedProjects = []Project{
+		{Name: "api", Branches: []Branch{
+			{Name: "master", Statuses: []Status{{Name: "test", Status: "failed", Author: "alice"}, {Name: "lint", Status: "success", Author: "bob"}}},
+			{Name: "develop", Statuses: []Status{{Name: "test", Status: "success", Author: "bob"}}},
+		}},
+		{Name: "web", Branches: []Branch{{Name: "master", Statuses: []Status{{Name: "test", Status: "running", Author: "carol"}}}}},
+	}
+	s.rebuildSummary(time.Now())
+	s.mu.Unlock()
+
+	get := func(url string, v interface{}) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", url, w.Code, w.Body)
+		}
+		err := json.Unmarshal(w.Body.Bytes(), v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var projects projectsResource
+	get("/api/projects", &projects)
+	if len(projects.Projects) != 2 || projects.Color != Red {
+		t.Errorf("unexpected projects %+v", projects)
+	}
+
+	// Filtering out the failure leaves a yellow summary
+	get("/api/projects?state=success,running", &projects)
+	if projects.Color != Yellow || len(projects.Projects) != 2 || len(projects.Projects[0].Branches) != 2 {
+		t.Errorf("unexpected filtered projects %+v", projects)
+	}
+
+	get("/api/projects?author=bob&project=api", &projects)
+	if len(projects.Projects) != 1 || projects.Color != Green {
+		t.Errorf("unexpected projects of bob %+v", projects)
+	}
+
+	var project projectResource
+	get("/api/projects/api", &project)
+	if project.Color != Red || len(project.Branches) != 2 || project.Branches[1].Color != Green {
+		t.Errorf("unexpected project %+v", project)
+	}
+
+	var branch branchResource
+	get("/api/projects/web/branches/master", &branch)
+	if branch.Name != "master" || branch.Color != Yellow {
+		t.Errorf("unexpected branch %+v", branch)
+	}
+
+	var statuses statusesResource
+	get("/api/projects/api/branches/master/statuses?job=lint", &statuses)
+	if len(statuses.Statuses) != 1 || statuses.Statuses[0].Name != "lint" || statuses.Color != Green {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", "/api/projects", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,180 @@
+package cistatus
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// stateVersion is the version of the state file format
+	stateVersion = 1
+
+	// stateSaveInterval is how often the state is saved when nothing but
+	// the times of the fetch health changed
+	stateSaveInterval = time.Minute
+)
+
+// serverState is the content of the state file
+type serverState struct {
+	Version        int           `json:"version"`
+	Saved          time.Time     `json:"saved"`
+	Summary        Summary       `json:"summary"`
+	PushedProjects []Project     `json:"pushedProjects,omitempty"`
+	FetchHealth    FetchHealth   `json:"fetchHealth"`
+	FlakyJobs      []flakyRecord `json:"flakyJobs,omitempty"`
+	Acks           []Ack         `json:"acks,omitempty"`
+
+	Maintenance       []MaintenanceWindow `json:"maintenance,omitempty"`
+	HeldNotifications []Notification      `json:"heldNotifications,omitempty"`
+}
+
+// saveState writes the latest summary, pushed projects, fetch health, flaky
+// job records, acks, maintenance windows and held notifications to
+// StatePath, if set. The file is replaced atomically so a crash never leaves
+// a partial state behind.
+func (s *Server) saveState() {
+	if s.StatePath == "" {
+		return
+	}
+
+	// Snapshots are taken and written in order so an older state can never
+	// replace a newer one
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	s.mu.RLock()
+	state := serverState{
+		Version:        stateVersion,
+		Saved:          time.Now(),
+		Summary:        s.latestSummary,
+		PushedProjects: s.pushedProjects,
+		FetchHealth:    s.fetchHealth,
+		FlakyJobs:      s.flaky.snapshot(),
+		Acks:           s.acks,
+
+		Maintenance:       s.maintenance,
+		HeldNotifications: s.heldNotifications,
+	}
+	s.mu.RUnlock()
+
+	err := writeState(s.StatePath, state)
+	if err != nil {
+		s.Logger.Printf("Error saving state: %s\n", err)
+		return
+	}
+	s.stateSaved = state.Saved
+}
+
+// saveStateIf saves the state when changed is set or the state was last
+// saved more than stateSaveInterval ago, so that unchanged polls do not
+// rewrite the file every time
+func (s *Server) saveStateIf(changed bool) {
+	s.stateMu.Lock()
+	stale := time.Since(s.stateSaved) >= stateSaveInterval
+	s.stateMu.Unlock()
+
+	if changed || stale {
+		s.saveState()
+	}
+}
+
+func writeState(path string, state serverState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode state")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return errors.Wrap(err, "unable to create state file")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to write state file")
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return errors.Wrap(err, "unable to replace state file")
+	}
+
+	return nil
+}
+
+// loadState restores the state saved in StatePath and reports whether there
+// was one. The summary is marked as restored until the first successful
+// fetch. A missing state file is not an error.
+func (s *Server) loadState() (bool, error) {
+	data, err := ioutil.ReadFile(s.StatePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "unable to read state file")
+	}
+
+	var state serverState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid state file")
+	}
+
+	if state.Version != stateVersion {
+		return false, errors.Errorf("unsupported state file version %d", state.Version)
+	}
+
+	s.mu.Lock()
+	s.restored = true
+	s.fetchedProjects = state.Summary.Projects
+	s.pushedProjects = state.PushedProjects
+	s.fetchHealth = state.FetchHealth
+	s.fetchHealth.Condition = FetchPending
+	s.flaky.restore(state.FlakyJobs, state.Summary.Projects)
+	s.acks = state.Acks
+	s.maintenance = endMaintenance(state.Maintenance, time.Now())
+	s.heldNotifications = state.HeldNotifications
+	s.rebuildSummary(time.Now())
+	s.notifyPrimed = true
+	if state.Summary.LastUpdated != nil {
+		s.latestSummary.LastUpdated = state.Summary.LastUpdated
+	}
+	s.mu.Unlock()
+
+	s.scheduleExpiries(state.PushedProjects)
+	s.scheduleAckExpiries(state.Acks)
+
+	s.Logger.Printf("Restored state saved at %s\n", state.Saved)
+	return true, nil
+}
+
+// scheduleExpiries schedules the expiry of every restored pushed status
+// with a TTL
+func (s *Server) scheduleExpiries(projects []Project) {
+	for _, project := range projects {
+		for _, branch := range project.Branches {
+			for _, status := range branch.Statuses {
+				if status.Expires == nil {
+					continue
+				}
+
+				projectName, branchName, statusName := project.Name, branch.Name, status.Name
+				time.AfterFunc(time.Until(*status.Expires), func() {
+					s.expireStatus(projectName, branchName, statusName)
+				})
+			}
+		}
+	}
+}
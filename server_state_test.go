@@ -0,0 +1,119 @@
+package cistatus
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// staticFetcher returns the same projects, or error, on every poll
+type staticFetcher struct {
+	projects []Project
+	err      error
+}
+
+func (f *staticFetcher) FetchStatus(ctx context.Context) ([]Project, error) {
+	return f.projects, f.err
+}
+
+func TestFetchSavesStateOnlyWhenChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cistatus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fetcher := &staticFetcher{projects: []Project{{
+		Name:     "api",
+		Branches: []Branch{{Name: "master", Commit: "abc", Statuses: []Status{{Name: "test", Status: "success"}}}},
+	}}}
+	s := NewServer(fetcher, time.Minute)
+	s.StatePath = filepath.Join(dir, "state.json")
+	go s.wsHub.run()
+
+	saved := func() time.Time {
+		s.stateMu.Lock()
+		defer s.stateMu.Unlock()
+		return s.stateSaved
+	}
+
+	s.fetch(context.Background(), false)
+	first := saved()
+	if first.IsZero() {
+		t.Fatal("the first poll did not save the state")
+	}
+
+	s.fetch(context.Background(), false)
+	if !saved().Equal(first) {
+		t.Error("an unchanged poll saved the state")
+	}
+
+	fetcher.err = errors.New("unreachable")
+	s.fetch(context.Background(), false)
+	failed := saved()
+	if failed.Equal(first) {
+		t.Error("a change of the fetch condition did not save the state")
+	}
+
+	s.fetch(context.Background(), false)
+	if !saved().Equal(failed) {
+		t.Error("a repeated failure saved the state")
+	}
+
+	fetcher.err = nil
+	fetcher.projects = []Project{{
+		Name:     "api",
+		Branches: []Branch{{Name: "master", Commit: "abc", Statuses: []Status{{Name: "test", Status: "success"}, {Name: "lint", Status: "success"}}}},
+	}}
+	s.fetch(context.Background(), false)
+	if saved().Equal(failed) {
+		t.Error("new statuses did not save the state")
+	}
+}
+
+func TestRestoredStateIsNotReady(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cistatus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fetcher := &staticFetcher{projects: []Project{{
+		Name:     "api",
+		Branches: []Branch{{Name: "master", Commit: "abc", Statuses: []Status{{Name: "test", Status: "success"}}}},
+	}}}
+	previous := NewServer(fetcher, time.Minute)
+	previous.StatePath = filepath.Join(dir, "state.json")
+	go previous.wsHub.run()
+	previous.fetch(context.Background(), false)
+
+	s := NewServer(fetcher, time.Minute)
+	s.StatePath = previous.StatePath
+	go s.wsHub.run()
+
+	restored, err := s.loadState()
+	if err != nil || !restored {
+		t.Fatalf("state not restored: %v", err)
+	}
+
+	ready := func() int {
+		w := httptest.NewRecorder()
+		s.readinessHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d before the first fetch, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	s.fetch(context.Background(), false)
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("expected %d after the first fetch, got %d", http.StatusOK, code)
+	}
+}
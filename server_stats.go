@@ -0,0 +1,68 @@
+package cistatus
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// statsHandler serves the reliability statistics computed from the
+// history. Requests must be authorized in the same way as /api/history. The
+// window is set with the since and until query parameters, which accept the
+// same values as /api/history, and defaults to the week before now. The
+// project and branch parameters select the branches.
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if s.History == nil {
+		http.Error(w, "history is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	since, until, err := parseStatsWindow(query, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := s.History.Stats(since, until, queryValues(query, "project"), queryValues(query, "branch"))
+	if err != nil {
+		s.Logger.Printf("Error computing stats: %s\n", err)
+		http.Error(w, "unable to read history", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// parseStatsWindow parses the since and until query parameters of
+// /api/stats
+func parseStatsWindow(query url.Values, now time.Time) (time.Time, time.Time, error) {
+	until, err := parseHistoryTime(query.Get("until"), now)
+	if err != nil {
+		return until, until, errors.Wrap(err, "invalid until")
+	}
+	if until.IsZero() {
+		until = now
+	}
+
+	since, err := parseHistoryTime(query.Get("since"), now)
+	if err != nil {
+		return since, until, errors.Wrap(err, "invalid since")
+	}
+	if since.IsZero() {
+		since = until.Add(-DefaultStatsWindow)
+	}
+
+	if !since.Before(until) {
+		return since, until, errors.New("since must be before until")
+	}
+
+	return since, until, nil
+}
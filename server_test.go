@@ -0,0 +1,79 @@
+package cistatus
+
+import (
+	"testing"
+	"time"
+)
+
+// statusesColor is the color of a single branch with statuses
+func statusesColor(statuses []Status, policy colorPolicy) Color {
+	return color([]Project{{Name: "api", Branches: []Branch{{Name: "master", Statuses: statuses}}}}, policy)
+}
+
+func TestColorPrecedence(t *testing.T) {
+	ack := &Ack{Comment: "known"}
+
+	tests := []struct {
+		statuses []Status
+		want     Color
+	}{
+		{nil, Green},
+		{[]Status{{Status: "success"}}, Green},
+		{[]Status{{Status: "success"}, {Status: "running"}}, Yellow},
+		{[]Status{{Status: "running"}, {Status: UnknownStatus}}, Unknown},
+		{[]Status{{Status: UnknownStatus}, {Status: "failed", Ack: ack}}, Acknowledged},
+		{[]Status{{Status: "failed", Ack: ack}, {Status: "failed"}}, Red},
+		{[]Status{{Status: UnknownStatus}, {Status: "failed"}}, Red},
+	}
+
+	for _, test := range tests {
+		if got := statusesColor(test.statuses, colorPolicy{}); got != test.want {
+			t.Errorf("%+v: color %s, want %s", test.statuses, got, test.want)
+		}
+	}
+}
+
+func TestColorPolicyRetried(t *testing.T) {
+	policy := colorPolicy{flakyThreshold: 0.2}
+	created := time.Now()
+	failed := Status{Name: "test", Status: "failed", Created: created, Flakiness: 0.5}
+
+	tests := []struct {
+		name     string
+		statuses []Status
+		want     Color
+	}{
+		{"not retried", []Status{failed}, Red},
+		{"retried", []Status{failed, {Name: "test", Status: "running", Created: created.Add(time.Minute)}}, Yellow},
+		{"queued again", []Status{failed, {Name: "test", Status: "pending", Created: created.Add(time.Minute)}}, Yellow},
+		{"older run pending", []Status{failed, {Name: "test", Status: "running", Created: created.Add(-time.Minute)}}, Red},
+		{"another job running", []Status{failed, {Name: "lint", Status: "running", Created: created.Add(time.Minute)}}, Red},
+		{"not flaky", []Status{{Name: "test", Status: "failed", Created: created, Flakiness: 0.1}, {Name: "test", Status: "running", Created: created.Add(time.Minute)}}, Red},
+	}
+
+	for _, test := range tests {
+		if got := statusesColor(test.statuses, policy); got != test.want {
+			t.Errorf("%s: color %s, want %s", test.name, got, test.want)
+		}
+		if got := statusesColor(test.statuses, colorPolicy{}); got != Red {
+			t.Errorf("%s: color %s without downgrade, want %s", test.name, got, Red)
+		}
+	}
+}
+
+func TestServerColorPolicy(t *testing.T) {
+	s := NewServer(&staticFetcher{}, time.Minute)
+	if policy := s.colorPolicy(); policy.flakyThreshold != 0 {
+		t.Errorf("policy %+v without FlakyDowngrade", policy)
+	}
+
+	s.FlakyDowngrade = true
+	if policy := s.colorPolicy(); policy.flakyThreshold != DefaultFlakyThreshold {
+		t.Errorf("policy %+v, want the default threshold", policy)
+	}
+
+	s.FlakyThreshold = 0.4
+	if policy := s.colorPolicy(); policy.flakyThreshold != 0.4 {
+		t.Errorf("policy %+v, want the configured threshold", policy)
+	}
+}
@@ -1,6 +1,9 @@
 package cistatus
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -20,12 +23,24 @@ var upgrader = websocket.Upgrader{
 
 // wsHub manages web socket connections and communications
 type wsHub struct {
+	// subscriberCount mirrors len(subscribers) for reading outside of run.
+	// It is first in the struct to keep it 64-bit aligned for atomic access.
+	subscriberCount int64
+
 	broadcast  chan Summary
 	register   chan *wsSubscriber
 	unregister chan *wsSubscriber
+	ping       chan chan struct{}
+	quit       chan struct{}
+	quitOnce   sync.Once
+	done       chan struct{}
 
 	subscribers   map[*wsSubscriber]bool
 	lastBroadcast Summary
+
+	// pumps tracks the running writePump goroutines so shutdown can wait
+	// for close frames to be delivered
+	pumps sync.WaitGroup
 }
 
 // newWSHub creates a new wsHub
@@ -35,18 +50,30 @@ func newWSHub() *wsHub {
 		broadcast:   make(chan Summary),
 		register:    make(chan *wsSubscriber),
 		unregister:  make(chan *wsSubscriber),
+		ping:        make(chan chan struct{}),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
 	}
 }
 
-// run starts the wsHub recieving on it's channels
+// run starts the wsHub recieving on it's channels until shutdown is called
 func (h *wsHub) run() {
+	defer close(h.done)
+
 	for {
 		select {
 		case s := <-h.register:
 			h.subscribers[s] = true
+			h.pumps.Add(1)
+			go func() {
+				defer h.pumps.Done()
+				s.writePump()
+			}()
+			go s.readPump(h)
 			if h.lastBroadcast.Color != "" {
-				s.write(h.lastBroadcast)
+				s.send <- h.lastBroadcast
 			}
+			h.countSubscribers()
 			break
 
 		case c := <-h.unregister:
@@ -55,16 +82,103 @@ func (h *wsHub) run() {
 				delete(h.subscribers, c)
 				close(c.send)
 			}
+			h.countSubscribers()
 			break
 
 		case s := <-h.broadcast:
 			h.send(s)
 			h.lastBroadcast = s
+			h.countSubscribers()
 			break
+
+		case reply := <-h.ping:
+			close(reply)
+			break
+
+		case <-h.quit:
+			for s := range h.subscribers {
+				delete(h.subscribers, s)
+				close(s.send)
+			}
+			h.countSubscribers()
+			return
 		}
 	}
 }
 
+// countSubscribers updates subscriberCount, it must only be called by run
+func (h *wsHub) countSubscribers() {
+	atomic.StoreInt64(&h.subscriberCount, int64(len(h.subscribers)))
+}
+
+// connected returns the number of connected subscribers
+func (h *wsHub) connected() int64 {
+	return atomic.LoadInt64(&h.subscriberCount)
+}
+
+// publish hands the summary to the hub for broadcast. It does not block
+// once the hub has stopped.
+func (h *wsHub) publish(summary Summary) {
+	select {
+	case h.broadcast <- summary:
+	case <-h.done:
+	}
+}
+
+// responsive reports whether the run loop answers a ping within timeout
+func (h *wsHub) responsive(timeout time.Duration) bool {
+	reply := make(chan struct{})
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	select {
+	case h.ping <- reply:
+	case <-deadline.C:
+		return false
+	}
+
+	select {
+	case <-reply:
+		return true
+	case <-deadline.C:
+		return false
+	}
+}
+
+// subscribe registers the subscriber with the hub, closing the connection
+// if the hub has already stopped.
+func (h *wsHub) subscribe(s *wsSubscriber) {
+	select {
+	case h.register <- s:
+	case <-h.done:
+		s.close()
+		s.ws.Close()
+	}
+}
+
+// shutdown stops the hub, sends a close frame to every subscriber and waits
+// for their connections to be closed or ctx to expire. It may be called
+// more than once, including concurrently.
+func (h *wsHub) shutdown(ctx context.Context) error {
+	h.quitOnce.Do(func() {
+		close(h.quit)
+	})
+
+	pumpsDone := make(chan struct{})
+	go func() {
+		<-h.done
+		h.pumps.Wait()
+		close(pumpsDone)
+	}()
+
+	select {
+	case <-pumpsDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // send sends the summary to all subscribers
 func (h *wsHub) send(summary Summary) {
 	for s := range h.subscribers {
@@ -73,9 +187,8 @@ func (h *wsHub) send(summary Summary) {
 			break
 
 		default:
-			go func() {
-				h.unregister <- s
-			}()
+			delete(h.subscribers, s)
+			close(s.send)
 		}
 	}
 }
@@ -90,12 +203,13 @@ type wsSubscriber struct {
 func newWSSubscriber(ws *websocket.Conn) *wsSubscriber {
 	return &wsSubscriber{
 		ws:   ws,
-		send: make(chan Summary),
+		send: make(chan Summary, 1),
 	}
 }
 
 // writePump handles incomming messages from the send channel to and
-// deliverers them to clients and sends ping messages.
+// deliverers them to clients and sends ping messages. When the send channel
+// is closed a close frame is sent and the connection is closed.
 func (s *wsSubscriber) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 
@@ -106,7 +220,8 @@ func (s *wsSubscriber) writePump() {
 		select {
 		case message, ok := <-s.send:
 			if !ok {
-				break
+				s.close()
+				return
 			}
 			err := s.write(message)
 			if err != nil {
@@ -121,6 +236,29 @@ func (s *wsSubscriber) writePump() {
 	}
 }
 
+// readPump reads (and discards) messages from the client so that control
+// frames are processed. The subscriber is unregistered once the connection
+// is closed by either side.
+func (s *wsSubscriber) readPump(h *wsHub) {
+	s.ws.SetReadLimit(maxMessageSize)
+	s.ws.SetReadDeadline(time.Now().Add(pongWait))
+	s.ws.SetPongHandler(func(string) error {
+		return s.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, _, err := s.ws.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+
+	select {
+	case h.unregister <- s:
+	case <-h.done:
+	}
+}
+
 // write sends the summary to the client websocket
 func (s *wsSubscriber) write(summary Summary) error {
 	s.ws.SetWriteDeadline(time.Now().Add(writeWait))
@@ -129,7 +267,8 @@ func (s *wsSubscriber) write(summary Summary) error {
 
 // close sends the websocket close signal to the client
 func (s *wsSubscriber) close() error {
-	return s.ws.WriteControl(websocket.CloseMessage, []byte{}, time.Now().Add(writeWait))
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+	return s.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
 }
 
 // close sends a ping to the client
@@ -0,0 +1,411 @@
+package cistatus
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultStatsWindow is the period covered by statistics by default
+const DefaultStatsWindow = 7 * 24 * time.Hour
+
+// Stats are the reliability statistics computed from the history over the
+// window from Since to Until
+type Stats struct {
+	Since    time.Time     `json:"since"`
+	Until    time.Time     `json:"until"`
+	Overall  ColorStats    `json:"overall"`
+	Branches []BranchStats `json:"branches"`
+}
+
+// ColorStats describe how long something was red, yellow and green. The
+// time shares are fractions of the time the color was known in the window.
+// A breakage is a change to red and a recovery a change from red, the mean
+// time to recovery covers the recoveries in the window.
+type ColorStats struct {
+	Breakages                 int     `json:"breakages"`
+	Recoveries                int     `json:"recoveries"`
+	MeanTimeToRecoverySeconds float64 `json:"meanTimeToRecoverySeconds"`
+	LongestRedSeconds         float64 `json:"longestRedSeconds"`
+	TimeRed                   float64 `json:"timeRed"`
+	TimeYellow                float64 `json:"timeYellow"`
+	TimeGreen                 float64 `json:"timeGreen"`
+}
+
+// BranchStats are the statistics of a branch. A run is a job finishing as
+// success or failed, the pass rate is the fraction of runs that succeeded.
+type BranchStats struct {
+	Project          string  `json:"project"`
+	Branch           string  `json:"branch"`
+	Runs             int     `json:"runs"`
+	Passed           int     `json:"passed"`
+	PassRate         float64 `json:"passRate"`
+	MedianJobSeconds float64 `json:"medianJobSeconds"`
+	ColorStats
+}
+
+// statsCheckpoint is the state of the replay of every transition before at,
+// from which the statistics of a window starting after at are computed
+// without replaying the history again
+type statsCheckpoint struct {
+	at       time.Time
+	overall  *colorTracker
+	trackers map[branchKey]*branchTracker
+}
+
+// Stats computes the statistics of the window from since to until for the
+// branches matching projects and branches, which match everything when nil.
+// The history before the window is replayed so the state at its start is
+// known. The state at the start of the latest window is kept so that the
+// next windows starting later only replay the history from there.
+func (h *HistoryStore) Stats(since, until time.Time, projects, branches map[string]bool) (Stats, error) {
+	overall := newColorTracker(since, until)
+	trackers := make(map[branchKey]*branchTracker)
+
+	h.statsMu.Lock()
+	checkpoint := h.statsCheckpoint
+	h.statsMu.Unlock()
+
+	var from time.Time
+	if checkpoint != nil && !checkpoint.at.After(since) {
+		from = checkpoint.at
+		overall = checkpoint.overall.copy(since, until)
+		for key, tracker := range checkpoint.trackers {
+			trackers[key] = tracker.copy(since, until)
+		}
+	}
+
+	var batch []Transition
+	flush := func() {
+		touched := make(map[*branchTracker]bool)
+		for _, t := range batch {
+			if t.Kind == ColorTransition {
+				overall.set(t.Time, Color(t.To))
+				continue
+			}
+
+			key := branchKey{t.Project, t.Branch}
+			tracker := trackers[key]
+			if tracker == nil {
+				tracker = newBranchTracker(since, until)
+				trackers[key] = tracker
+			}
+			tracker.apply(t)
+			touched[tracker] = true
+		}
+
+		// The color of a branch is only updated once all the transitions
+		// recorded at the same time are applied
+		for tracker := range touched {
+			tracker.update(batch[0].Time)
+		}
+		batch = batch[:0]
+	}
+
+	checkpointed := false
+	err := h.eachFrom(from, func(t Transition) bool {
+		if t.Time.Before(from) {
+			return true
+		}
+		if !t.Time.Before(until) {
+			return false
+		}
+
+		if len(batch) > 0 && !t.Time.Equal(batch[0].Time) {
+			flush()
+		}
+
+		// Every transition before the window is replayed once the first
+		// one in the window is reached
+		if !checkpointed && !t.Time.Before(since) {
+			checkpointed = true
+			h.saveStatsCheckpoint(since, overall, trackers)
+		}
+
+		batch = append(batch, t)
+		return true
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+
+	stats := Stats{
+		Since:    since,
+		Until:    until,
+		Overall:  overall.finish(),
+		Branches: []BranchStats{},
+	}
+
+	for key, tracker := range trackers {
+		if projects != nil && !projects[key.project] || branches != nil && !branches[key.branch] {
+			continue
+		}
+
+		colorStats := tracker.color.finish()
+		if tracker.runs == 0 && colorStats.TimeRed+colorStats.TimeYellow+colorStats.TimeGreen == 0 {
+			continue
+		}
+
+		branch := BranchStats{
+			Project:          key.project,
+			Branch:           key.branch,
+			Runs:             tracker.runs,
+			Passed:           tracker.passed,
+			MedianJobSeconds: median(tracker.durations).Seconds(),
+			ColorStats:       colorStats,
+		}
+		if tracker.runs > 0 {
+			branch.PassRate = float64(tracker.passed) / float64(tracker.runs)
+		}
+		stats.Branches = append(stats.Branches, branch)
+	}
+
+	sort.Slice(stats.Branches, func(i, j int) bool {
+		if stats.Branches[i].Project != stats.Branches[j].Project {
+			return stats.Branches[i].Project < stats.Branches[j].Project
+		}
+		return stats.Branches[i].Branch < stats.Branches[j].Branch
+	})
+
+	return stats, nil
+}
+
+// saveStatsCheckpoint keeps the replayed state before at, unless the
+// checkpoint already kept is later
+func (h *HistoryStore) saveStatsCheckpoint(at time.Time, overall *colorTracker, trackers map[branchKey]*branchTracker) {
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+
+	if h.statsCheckpoint != nil && !h.statsCheckpoint.at.Before(at) {
+		return
+	}
+
+	checkpoint := &statsCheckpoint{
+		at:       at,
+		overall:  overall.copy(at, at),
+		trackers: make(map[branchKey]*branchTracker, len(trackers)),
+	}
+	for key, tracker := range trackers {
+		checkpoint.trackers[key] = tracker.copy(at, at)
+	}
+	h.statsCheckpoint = checkpoint
+}
+
+type branchKey struct {
+	project, branch string
+}
+
+// branchTracker replays the job transitions of a branch. The jobs are those
+// of the commit of the latest transition.
+type branchTracker struct {
+	since, until time.Time
+	commit       string
+	jobs         map[string]string
+	started      map[string]time.Time
+	color        *colorTracker
+
+	runs, passed int
+	durations    []time.Duration
+}
+
+func newBranchTracker(since, until time.Time) *branchTracker {
+	return &branchTracker{
+		since:   since,
+		until:   until,
+		jobs:    make(map[string]string),
+		started: make(map[string]time.Time),
+		color:   newColorTracker(since, until),
+	}
+}
+
+// copy returns a tracker for the window from since to until starting from
+// the state of b. Only the state is copied as it is only copied before any
+// window.
+func (b *branchTracker) copy(since, until time.Time) *branchTracker {
+	c := newBranchTracker(since, until)
+	c.commit = b.commit
+	for job, state := range b.jobs {
+		c.jobs[job] = state
+	}
+	for job, start := range b.started {
+		c.started[job] = start
+	}
+	c.color = b.color.copy(since, until)
+	return c
+}
+
+func (b *branchTracker) apply(t Transition) {
+	// The jobs of an earlier commit, which may have been removed or
+	// renamed since, no longer count towards the color
+	if t.Commit != b.commit {
+		b.commit = t.Commit
+		b.jobs = make(map[string]string)
+		b.started = make(map[string]time.Time)
+	}
+
+	b.jobs[t.Job] = t.To
+	inWindow := !t.Time.Before(b.since)
+
+	switch t.To {
+	case "pending":
+		if _, ok := b.started[t.Job]; !ok {
+			b.started[t.Job] = t.Time
+		}
+	case "running":
+		// Time spent pending is not part of the job duration
+		b.started[t.Job] = t.Time
+	case "success", "failed":
+		if inWindow {
+			b.runs++
+			if t.To == "success" {
+				b.passed++
+			}
+			if start, ok := b.started[t.Job]; ok {
+				b.durations = append(b.durations, t.Time.Sub(start))
+			}
+		}
+		delete(b.started, t.Job)
+	default:
+		delete(b.started, t.Job)
+	}
+}
+
+// update sets the color of the branch from the states of its jobs
+func (b *branchTracker) update(at time.Time) {
+	var statuses []Status
+	for job, state := range b.jobs {
+		statuses = append(statuses, Status{Name: job, Status: state})
+	}
+	b.color.set(at, branchColor(Branch{Statuses: statuses}, colorPolicy{}))
+}
+
+// colorTracker accumulates ColorStats from a sequence of colors
+type colorTracker struct {
+	since, until time.Time
+
+	color    Color
+	changed  time.Time
+	redStart time.Time
+
+	durations     map[Color]time.Duration
+	breakages     int
+	recoveries    int
+	recoveryTotal time.Duration
+	longestRed    time.Duration
+}
+
+func newColorTracker(since, until time.Time) *colorTracker {
+	return &colorTracker{
+		since:     since,
+		until:     until,
+		durations: make(map[Color]time.Duration),
+	}
+}
+
+// copy returns a tracker for the window from since to until starting from
+// the color of c
+func (c *colorTracker) copy(since, until time.Time) *colorTracker {
+	copied := newColorTracker(since, until)
+	copied.color = c.color
+	copied.changed = c.changed
+	copied.redStart = c.redStart
+	return copied
+}
+
+func (c *colorTracker) set(at time.Time, color Color) {
+	// An acknowledged failure is still a failure
+	if color == Acknowledged {
+		color = Red
+	}
+	if color == c.color {
+		return
+	}
+	c.accumulate(at)
+
+	inWindow := !at.Before(c.since)
+	if color == Red {
+		c.redStart = at
+		if inWindow {
+			c.breakages++
+		}
+	}
+	if c.color == Red && inWindow {
+		red := at.Sub(c.redStart)
+		c.recoveries++
+		c.recoveryTotal += red
+		if red > c.longestRed {
+			c.longestRed = red
+		}
+	}
+
+	c.color = color
+	c.changed = at
+}
+
+// accumulate adds the time in the window spent in the current color up to
+// at
+func (c *colorTracker) accumulate(at time.Time) {
+	if c.color == "" {
+		return
+	}
+
+	start, end := c.changed, at
+	if start.Before(c.since) {
+		start = c.since
+	}
+	if end.After(c.until) {
+		end = c.until
+	}
+	if end.After(start) {
+		c.durations[c.color] += end.Sub(start)
+	}
+}
+
+// finish accounts for the color at the end of the window and returns the
+// statistics
+func (c *colorTracker) finish() ColorStats {
+	c.accumulate(c.until)
+	if c.color == Red {
+		// Still red, the streak so far counts
+		if red := c.until.Sub(c.redStart); red > c.longestRed {
+			c.longestRed = red
+		}
+	}
+
+	var stats ColorStats
+	stats.Breakages = c.breakages
+	stats.Recoveries = c.recoveries
+	stats.LongestRedSeconds = c.longestRed.Seconds()
+	if c.recoveries > 0 {
+		stats.MeanTimeToRecoverySeconds = (c.recoveryTotal / time.Duration(c.recoveries)).Seconds()
+	}
+
+	total := c.durations[Red] + c.durations[Yellow] + c.durations[Green]
+	if total > 0 {
+		stats.TimeRed = float64(c.durations[Red]) / float64(total)
+		stats.TimeYellow = float64(c.durations[Yellow]) / float64(total)
+		stats.TimeGreen = float64(c.durations[Green]) / float64(total)
+	}
+
+	return stats
+}
+
+// median returns the median of durations, or zero when there are none
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,102 @@
+package cistatus
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestHistory(t *testing.T) (*HistoryStore, func()) {
+	dir, err := ioutil.TempDir("", "cistatus-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := OpenHistory(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return h, func() {
+		h.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func recordBranch(t *testing.T, h *HistoryStore, at time.Time, commit string, statuses ...Status) {
+	projects := []Project{{Name: "api", Branches: []Branch{{Name: "master", Commit: commit, Statuses: statuses}}}}
+	err := h.record(at, projects, color(projects, colorPolicy{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatsForgetJobsOfEarlierCommits(t *testing.T) {
+	h, cleanup := openTestHistory(t)
+	defer cleanup()
+
+	start := time.Now().Add(-4 * time.Hour).Truncate(time.Second)
+	recordBranch(t, h, start, "abc", Status{Name: "build", Status: "success"}, Status{Name: "lint", Status: "failed"})
+	// The lint job is removed by the next commit
+	recordBranch(t, h, start.Add(time.Hour), "def", Status{Name: "build", Status: "success"})
+
+	h.Close()
+
+	stats, err := h.Stats(start, start.Add(4*time.Hour), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Branches) != 1 {
+		t.Fatalf("unexpected branches %+v", stats.Branches)
+	}
+
+	branch := stats.Branches[0]
+	if branch.TimeRed != 0.25 || branch.TimeGreen != 0.75 || branch.Recoveries != 1 {
+		t.Errorf("the job of an earlier commit kept the branch red: %+v", branch.ColorStats)
+	}
+}
+
+func TestStatsCheckpoint(t *testing.T) {
+	h, cleanup := openTestHistory(t)
+	defer cleanup()
+
+	start := time.Now().Add(-10 * time.Hour).Truncate(time.Second)
+	commits := []string{"a", "b", "c", "d", "e"}
+	for i, commit := range commits {
+		at := start.Add(time.Duration(2*i) * time.Hour)
+		recordBranch(t, h, at, commit, Status{Name: "test", Status: "running"})
+		state := "success"
+		if i%2 == 0 {
+			state = "failed"
+		}
+		recordBranch(t, h, at.Add(30*time.Minute), commit, Status{Name: "test", Status: state})
+	}
+
+	h.Close()
+
+	until := start.Add(10 * time.Hour)
+	for _, since := range []time.Time{start.Add(3 * time.Hour), start.Add(5 * time.Hour), start.Add(4 * time.Hour), start.Add(7 * time.Hour)} {
+		got, err := h.Stats(since, until, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A store without a checkpoint replays the whole history
+		fresh := &HistoryStore{Dir: h.Dir}
+		want, err := fresh.Stats(since, until, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("since %s: got %+v, want %+v", since, got, want)
+		}
+	}
+
+	if h.statsCheckpoint == nil || !h.statsCheckpoint.at.Equal(start.Add(7*time.Hour)) {
+		t.Errorf("unexpected checkpoint %+v", h.statsCheckpoint)
+	}
+}